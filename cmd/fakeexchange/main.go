@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"marketflow/pkg/fakeexchange"
+	"marketflow/pkg/logger"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func main() {
+	port := flag.String("port", "40101", "Port to listen on")
+	symbols := flag.String("symbols", "", "Comma separated symbols, all known symbols by default")
+	rate := flag.Float64("rate", 10, "Lines per second and connection")
+	volatility := flag.Float64("volatility", 0.0005, "Relative standard deviation of a price step")
+	disconnect := flag.Duration("disconnect-every", 0, "Close every connection after this long, never if zero")
+	malformed := flag.Float64("malformed", 0, "Share of lines sent malformed, between 0 and 1")
+	seed := flag.Int64("seed", 0, "Seed of prices and malformed lines, random if zero")
+	flag.Parse()
+
+	logger.Init()
+
+	cfg := fakeexchange.Config{
+		Addr:            ":" + *port,
+		Rate:            *rate,
+		Volatility:      *volatility,
+		DisconnectEvery: *disconnect,
+		MalformedRate:   *malformed,
+		Seed:            *seed,
+	}
+	if *symbols != "" {
+		cfg.Symbols = strings.Split(*symbols, ",")
+	}
+
+	srv := fakeexchange.New(cfg)
+	if err := srv.Start(); err != nil {
+		logger.Error("Failed to start fake exchange", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("Fake exchange is listening", "address", srv.Addr(), "rate", *rate, "disconnect_every", disconnect.String(), "malformed", *malformed)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	status := time.NewTicker(time.Minute)
+	defer status.Stop()
+
+	for {
+		select {
+		case <-stop:
+			logger.Info("Shutting down fake exchange...")
+			srv.Close()
+			return
+		case <-status.C:
+			logger.Info("Fake exchange status", "connections", srv.Connections())
+		}
+	}
+}
@@ -2,9 +2,14 @@ package main
 
 import (
 	"marketflow/internal/app"
+	"os"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(app.Migrate(os.Args[2:]))
+	}
+
 	app.Flags()
 
 	srv, cleanup := app.SetupApp()
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"marketflow/internal/adapters/recorder"
+	"marketflow/internal/domain"
+	"marketflow/internal/domain/utils"
+	"marketflow/pkg/logger"
+	"net/http"
+	"strings"
+)
+
+type AdminHandler struct {
+	recorder *recorder.Recorder
+}
+
+func NewAdminHandler(recorder *recorder.Recorder) *AdminHandler {
+	return &AdminHandler{recorder: recorder}
+}
+
+// Core handler for starting and stopping the live feed recording
+func (h *AdminHandler) SwitchRecording(w http.ResponseWriter, r *http.Request) {
+	if !authorized(w, r) {
+		return
+	}
+	if h.recorder == nil {
+		utils.SendMsg(w, http.StatusNotFound, domain.ErrRecordingNotConfigured.Error())
+		return
+	}
+
+	var err error
+	action := r.PathValue("action")
+	switch action {
+	case "start":
+		err = h.recorder.Start()
+	case "stop":
+		err = h.recorder.Stop()
+	default:
+		utils.SendMsg(w, http.StatusBadRequest, domain.ErrInvalidRecordingAction.Error())
+		return
+	}
+
+	switch err {
+	case nil:
+	case domain.ErrRecordingStarted, domain.ErrRecordingStopped:
+		utils.SendMsg(w, http.StatusConflict, err.Error())
+		return
+	default:
+		logger.Error("Failed to switch recording", "action", action, "error", err.Error())
+		utils.SendMsg(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := utils.SendJSON(w, http.StatusOK, h.recorder.Status()); err != nil {
+		logger.Error("Failed to send recording status: " + err.Error())
+	}
+}
+
+// Core handler for the live feed recording status
+func (h *AdminHandler) RecordingStatus(w http.ResponseWriter, r *http.Request) {
+	if !authorized(w, r) {
+		return
+	}
+	if h.recorder == nil {
+		utils.SendMsg(w, http.StatusNotFound, domain.ErrRecordingNotConfigured.Error())
+		return
+	}
+
+	if err := utils.SendJSON(w, http.StatusOK, h.recorder.Status()); err != nil {
+		logger.Error("Failed to send recording status: " + err.Error())
+	}
+}
+
+// Checks the bearer token when domain.AdminToken is set and answers 401 if it does not match
+func authorized(w http.ResponseWriter, r *http.Request) bool {
+	if domain.AdminToken == "" {
+		return true
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if ok && subtle.ConstantTimeCompare([]byte(token), []byte(domain.AdminToken)) == 1 {
+		return true
+	}
+
+	utils.SendMsg(w, http.StatusUnauthorized, domain.ErrAdminUnauthorized.Error())
+	return false
+}
@@ -0,0 +1,45 @@
+package handlers_test
+
+import (
+	"marketflow/internal/apptest"
+	"marketflow/internal/domain"
+	"net/http"
+	"testing"
+)
+
+func TestAdminToken(t *testing.T) {
+	h := apptest.New(t)
+	token := domain.AdminToken
+	t.Cleanup(func() { domain.AdminToken = token })
+	domain.AdminToken = "secret"
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"wrong token", "Bearer guess", http.StatusUnauthorized},
+		{"not a bearer token", "secret", http.StatusUnauthorized},
+		// The harness runs without a recorder
+		{"token", "Bearer secret", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(http.MethodGet, h.Server.URL+"/admin/recording", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+
+		resp, err := h.Server.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, resp.StatusCode, tt.want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"marketflow/internal/domain"
+	"marketflow/internal/domain/utils"
+	"marketflow/pkg/logger"
+	"net/http"
+)
+
+// Core handler for OHLC candles of a specific exchange and symbol
+func (h *MarketDataHTTPHandler) Candles(w http.ResponseWriter, r *http.Request) {
+	exchange := r.PathValue("exchange")
+	if len(exchange) == 0 {
+		logger.Error("Failed to get exchange value from path: ", "error", domain.ErrEmptyExchangeVal.Error())
+		utils.SendMsg(w, http.StatusBadRequest, domain.ErrEmptyExchangeVal.Error())
+		return
+	}
+
+	symbol := r.PathValue("symbol")
+	if len(symbol) == 0 {
+		logger.Error("Failed to get symbol value from path: ", "error", domain.ErrEmptySymbolVal.Error())
+		utils.SendMsg(w, http.StatusBadRequest, domain.ErrEmptySymbolVal.Error())
+		return
+	}
+
+	query := r.URL.Query()
+	interval := query.Get("interval")
+	if interval == "" {
+		interval = utils.FormatInterval(domain.AggregationWindow)
+	}
+
+	candles, code, err := h.serv.Candles(exchange, symbol, interval, query.Get("from"), query.Get("to"))
+	if err != nil {
+		logger.Error("Failed to get candles: ", "exchange", exchange, "symbol", symbol, "interval", interval, "error", err.Error())
+		utils.SendMsg(w, code, err.Error())
+		return
+	}
+
+	data := struct {
+		Exchange string          `json:"exchange"`
+		Symbol   string          `json:"symbol"`
+		Interval string          `json:"interval"`
+		Candles  []domain.Candle `json:"candles"`
+	}{
+		Exchange: exchange,
+		Symbol:   symbol,
+		Interval: interval,
+		Candles:  candles,
+	}
+
+	if err := utils.SendJSON(w, code, data); err != nil {
+		logger.Error("Failed to send candles: ", "exchange", exchange, "symbol", symbol, "error", err.Error())
+		return
+	}
+
+	logger.Info("Candles sent", "exchange", exchange, "symbol", symbol, "interval", interval, "count", len(candles))
+}
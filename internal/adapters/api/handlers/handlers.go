@@ -1,25 +1,40 @@
 package handlers
 
 import (
-	"fmt"
 	"marketflow/internal/adapters/api/server"
 	"marketflow/internal/domain"
+	"marketflow/pkg/metrics"
 	"net/http"
-	"time"
 )
 
-func Setup(db domain.Database, cacheMemory domain.CacheMemory, datafetch *server.DataModeServiceImp) *http.ServeMux {
+// Setup registers the routes, every request is measured by the route pattern it matched
+func Setup(db domain.Database, cacheMemory domain.CacheMemory, datafetch *server.DataModeServiceImp) http.Handler {
 	modeHandler := NewSwitchModeHandler(datafetch)
 	marketHandler := NewMarketDataHandler(datafetch)
+	streamHandler := NewStreamHandler(datafetch.Hub)
+	adminHandler := NewAdminHandler(datafetch.Recorder)
 
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("POST /mode/{mode}", modeHandler.SwitchMode) // Switch to MODE
 
-	mux.HandleFunc("GET /health", modeHandler.CheckHealth) // Returns system status
+	mux.HandleFunc("GET /health", modeHandler.CheckHealth)     // Returns system status
+	mux.HandleFunc("GET /health/live", modeHandler.Liveness)   // Liveness probe
+	mux.HandleFunc("GET /health/ready", modeHandler.Readiness) // Readiness probe
+
+	mux.HandleFunc("POST /admin/recording/{action}", adminHandler.SwitchRecording) // Start or stop recording live feeds
+	mux.HandleFunc("GET /admin/recording", adminHandler.RecordingStatus)
 
 	mux.HandleFunc("GET /prices/{metric}/{symbol}", marketHandler.ProcessMetricQueryByAll)
 	mux.HandleFunc("GET /prices/{metric}/{exchange}/{symbol}", marketHandler.ProcessMetricQueryByExchange)
-	fmt.Println(time.Now())
-	return mux
+	mux.HandleFunc("GET /prices/history/{exchange}/{symbol}", marketHandler.PriceHistory) // Stored series in an absolute range
+
+	mux.HandleFunc("GET /candles/{exchange}/{symbol}", marketHandler.Candles) // OHLC series
+
+	mux.HandleFunc("GET /stream/prices", streamHandler.StreamPrices) // Server-Sent Events of price updates
+	mux.HandleFunc("GET /ws", streamHandler.WebSocket)               // WebSocket subscriptions
+
+	mux.Handle("GET /metrics", metrics.Handler()) // Prometheus metrics
+
+	return metrics.Instrument(mux)
 }
@@ -15,3 +15,18 @@ func (h *ModeHandler) CheckHealth(w http.ResponseWriter, r *http.Request) {
 		utils.SendMsg(w, http.StatusInternalServerError, err.Error())
 	}
 }
+
+// Liveness probe, answers as long as the server handles requests
+func (h *ModeHandler) Liveness(w http.ResponseWriter, r *http.Request) {
+	utils.SendMsg(w, http.StatusOK, "alive")
+}
+
+// Readiness probe, fails while the service can not serve data
+func (h *ModeHandler) Readiness(w http.ResponseWriter, r *http.Request) {
+	res := h.serv.CheckHealth()
+	if !res.Ready {
+		utils.SendMsg(w, http.StatusServiceUnavailable, "not ready, status is "+res.Status)
+		return
+	}
+	utils.SendMsg(w, http.StatusOK, "ready, status is "+res.Status)
+}
@@ -0,0 +1,113 @@
+package handlers_test
+
+import (
+	"errors"
+	"marketflow/internal/apptest"
+	"marketflow/internal/domain"
+	"marketflow/pkg/fakeexchange"
+	"net/http"
+	"testing"
+)
+
+func TestHealth(t *testing.T) {
+	h := apptest.New(t)
+	h.Push(apptest.Tick("Exchange1", domain.BTCUSDT, 60000))
+
+	var got domain.HealthReport
+	if code := h.Get("/health", &got); code != http.StatusOK {
+		t.Fatalf("status %d, want %d", code, http.StatusOK)
+	}
+	if got.Status != domain.HealthHealthy || !got.Ready || got.Mode != domain.ModeTest {
+		t.Errorf("health = %+v, want healthy and ready in test mode", got)
+	}
+	if got.BufferSize == 0 {
+		t.Error("buffer size = 0 after a pushed tick")
+	}
+	if got.Database.Status != domain.HealthHealthy || got.Cache.Status != domain.HealthHealthy {
+		t.Errorf("stores = %+v %+v, want healthy", got.Database, got.Cache)
+	}
+
+	var msg apptest.Message
+	if code := h.Get("/health/live", &msg); code != http.StatusOK {
+		t.Errorf("liveness: status %d, want %d", code, http.StatusOK)
+	}
+	if code := h.Get("/health/ready", &msg); code != http.StatusOK {
+		t.Errorf("readiness: status %d, want %d (%s)", code, http.StatusOK, msg.Message)
+	}
+}
+
+func TestHealthDegraded(t *testing.T) {
+	h := apptest.New(t)
+	h.Fetcher.Fail(errors.New("exchange Exchange2 is not responding"))
+	h.Cache.Fail(errors.New("cache is down"))
+
+	var got domain.HealthReport
+	h.Get("/health", &got)
+	if got.Status != domain.HealthDegraded || !got.Ready {
+		t.Errorf("status = %s, ready = %v, want degraded and ready", got.Status, got.Ready)
+	}
+	if got.FetcherError != "exchange Exchange2 is not responding" {
+		t.Errorf("fetcher error = %q", got.FetcherError)
+	}
+	if got.Cache.Status != domain.HealthUnhealthy || got.Cache.Error != "cache is down" {
+		t.Errorf("cache = %+v, want unhealthy", got.Cache)
+	}
+
+	if code := h.Get("/health/ready", nil); code != http.StatusOK {
+		t.Errorf("readiness: status %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestHealthNotReadyWithoutDatabase(t *testing.T) {
+	h := apptest.New(t)
+	h.DB.Fail(errors.New("database is down"))
+
+	var got domain.HealthReport
+	h.Get("/health", &got)
+	if got.Status != domain.HealthUnhealthy || got.Ready {
+		t.Errorf("status = %s, ready = %v, want unhealthy and not ready", got.Status, got.Ready)
+	}
+	if got.Database.Error != "database is down" {
+		t.Errorf("database = %+v", got.Database)
+	}
+
+	if code := h.Get("/health/ready", nil); code != http.StatusServiceUnavailable {
+		t.Errorf("readiness: status %d, want %d", code, http.StatusServiceUnavailable)
+	}
+	if code := h.Get("/health/live", nil); code != http.StatusOK {
+		t.Errorf("liveness: status %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestHealthReportsExchanges(t *testing.T) {
+	h := apptest.New(t)
+
+	server := fakeexchange.New(fakeexchange.Config{Addr: "127.0.0.1:0", Rate: 200, MalformedRate: 0.5, Seed: 1})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+	t.Setenv("EXCHANGES", "Exchange1="+server.Addr())
+
+	if code := h.Post("/mode/live", nil); code != http.StatusOK {
+		t.Fatalf("switch to live: status %d", code)
+	}
+
+	var got domain.HealthReport
+	h.Eventually(func() bool {
+		h.Get("/health", &got)
+		return len(got.Exchanges) == 1 && got.Exchanges[0].ParseErrors > 0 && got.Exchanges[0].ClockSkewMs != nil
+	})
+
+	exch := got.Exchanges[0]
+	if got.Mode != domain.ModeLive || got.Status != domain.HealthHealthy || !got.Ready {
+		t.Errorf("health = %+v, want healthy and ready in live mode", got)
+	}
+	if exch.Name != "Exchange1" || exch.State != domain.ConnConnected || exch.LastMessage == nil || exch.MessagesPerSec == 0 {
+		t.Errorf("exchange = %+v, want connected and receiving", exch)
+	}
+	// The fake exchange stamps the lines with the local clock
+	if skew := *exch.ClockSkewMs; skew < 0 || skew > 1000 {
+		t.Errorf("clock skew = %dms, want a small delay", skew)
+	}
+}
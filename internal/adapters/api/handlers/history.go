@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"marketflow/internal/domain"
+	"marketflow/internal/domain/utils"
+	"marketflow/pkg/logger"
+	"net/http"
+)
+
+// Core handler for the stored price series of a specific exchange and symbol
+func (h *MarketDataHTTPHandler) PriceHistory(w http.ResponseWriter, r *http.Request) {
+	exchange := r.PathValue("exchange")
+	if len(exchange) == 0 {
+		logger.Error("Failed to get exchange value from path: ", "error", domain.ErrEmptyExchangeVal.Error())
+		utils.SendMsg(w, http.StatusBadRequest, domain.ErrEmptyExchangeVal.Error())
+		return
+	}
+
+	symbol := r.PathValue("symbol")
+	if len(symbol) == 0 {
+		logger.Error("Failed to get symbol value from path: ", "error", domain.ErrEmptySymbolVal.Error())
+		utils.SendMsg(w, http.StatusBadRequest, domain.ErrEmptySymbolVal.Error())
+		return
+	}
+
+	query := r.URL.Query()
+	history, code, err := h.serv.PriceHistory(exchange, symbol, query.Get("from"), query.Get("to"), query.Get("step"), query.Get("limit"), query.Get("offset"))
+	if err != nil {
+		logger.Error("Failed to get price history: ", "exchange", exchange, "symbol", symbol, "error", err.Error())
+		utils.SendMsg(w, code, err.Error())
+		return
+	}
+
+	if err := utils.SendJSON(w, code, history); err != nil {
+		logger.Error("Failed to send price history: ", "exchange", exchange, "symbol", symbol, "error", err.Error())
+		return
+	}
+
+	logger.Info("Price history sent", "exchange", exchange, "symbol", symbol, "points", len(history.Points))
+}
@@ -26,10 +26,11 @@ const (
 // Core handler for processing metric-based queries by specific exchange
 func (h *MarketDataHTTPHandler) ProcessMetricQueryByExchange(w http.ResponseWriter, r *http.Request) {
 	var (
-		data domain.Data
-		msg  string
-		code int = 200
-		err  error
+		data     domain.Data
+		fallback int64 // the latest price carries its own time, when no tick was seen since startup
+		msg      string
+		code     int = 200
+		err      error
 	)
 
 	metric := r.PathValue("metric")
@@ -119,6 +120,7 @@ func (h *MarketDataHTTPHandler) ProcessMetricQueryByExchange(w http.ResponseWrit
 			utils.SendMsg(w, code, err.Error())
 			return
 		}
+		fallback = data.Timestamp
 		msg = fmt.Sprintf("Latest price for %s at %s: %.2f", symbol, exchange, data.Price)
 
 	default:
@@ -127,7 +129,14 @@ func (h *MarketDataHTTPHandler) ProcessMetricQueryByExchange(w http.ResponseWrit
 		return
 	}
 
-	if err := utils.SendMetricData(w, code, data); err != nil {
+	freshness, code, err := h.serv.Freshness(exchange, symbol, fallback)
+	if err != nil {
+		logger.Warn("Refused stale price: ", "exchange", exchange, "symbol", symbol, "metric", metric)
+		utils.SendMsg(w, code, err.Error())
+		return
+	}
+
+	if err := utils.SendMetricData(w, code, data, freshness); err != nil {
 		logger.Error("Failed to send JSON message: ", "data", data, "error", err.Error())
 		utils.SendMsg(w, code, err.Error())
 		return
@@ -141,6 +150,7 @@ func (h *MarketDataHTTPHandler) ProcessMetricQueryByAll(w http.ResponseWriter, r
 	var (
 		data     domain.Data
 		exchange = "All"
+		fallback int64 // the latest price carries its own time, when no tick was seen since startup
 		msg      string
 		code     int = 200
 		err      error
@@ -213,6 +223,7 @@ func (h *MarketDataHTTPHandler) ProcessMetricQueryByAll(w http.ResponseWriter, r
 			utils.SendMsg(w, code, err.Error())
 			return
 		}
+		fallback = data.Timestamp
 
 		msg = fmt.Sprintf("Latest price for %s at %s: %.2f", symbol, exchange, data.Price)
 	default:
@@ -221,7 +232,14 @@ func (h *MarketDataHTTPHandler) ProcessMetricQueryByAll(w http.ResponseWriter, r
 		return
 	}
 
-	if err := utils.SendMetricData(w, code, data); err != nil {
+	freshness, code, err := h.serv.Freshness(exchange, symbol, fallback)
+	if err != nil {
+		logger.Warn("Refused stale price: ", "exchange", exchange, "symbol", symbol, "metric", metric)
+		utils.SendMsg(w, code, err.Error())
+		return
+	}
+
+	if err := utils.SendMetricData(w, code, data, freshness); err != nil {
 		logger.Error("Failed to send JSON message: ", "data", data, "error", err.Error())
 		utils.SendMsg(w, code, err.Error())
 		return
@@ -0,0 +1,306 @@
+package handlers_test
+
+import (
+	"errors"
+	"marketflow/internal/apptest"
+	"marketflow/internal/domain"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Stores one aggregated row of two ticks per exchange and for "All", stamped at the given time
+func storeAggregate(h *apptest.Harness, symbol string, at time.Time, avg, min, max float64) {
+	rows := make(map[string]domain.ExchangeData)
+	for _, exchange := range domain.Exchanges {
+		rows[exchange+" "+symbol] = domain.ExchangeData{
+			Pair_name:     symbol,
+			Exchange:      exchange,
+			Timestamp:     at,
+			Average_price: avg,
+			Min_price:     min,
+			Max_price:     max,
+			Open_price:    avg,
+			Close_price:   avg,
+			Tick_count:    2,
+			Price_sum:     2 * avg,
+		}
+	}
+	h.DB.SaveAggregatedData(rows)
+}
+
+func TestLatestPrice(t *testing.T) {
+	h := apptest.New(t)
+	h.Push(
+		apptest.Tick("Exchange1", domain.BTCUSDT, 60000),
+		apptest.Tick("Exchange2", domain.BTCUSDT, 60100),
+		apptest.Tick("Exchange1", domain.BTCUSDT, 60200),
+	)
+
+	tests := []struct {
+		path     string
+		exchange string
+		price    float64
+	}{
+		{"/prices/latest/Exchange1/BTCUSDT", "Exchange1", 60200},
+		{"/prices/latest/Exchange2/BTCUSDT", "Exchange2", 60100},
+		{"/prices/latest/BTCUSDT", "Exchange1", 60200},
+	}
+	for _, tt := range tests {
+		var got apptest.Metric
+		if code := h.Get(tt.path, &got); code != http.StatusOK {
+			t.Fatalf("GET %s: status %d, want %d", tt.path, code, http.StatusOK)
+		}
+		if got.Exchange != tt.exchange || got.Symbol != domain.BTCUSDT || got.Price != tt.price {
+			t.Errorf("GET %s = %+v, want %s %s %v", tt.path, got, tt.exchange, domain.BTCUSDT, tt.price)
+		}
+	}
+}
+
+func TestLatestPriceFallsBackToDatabase(t *testing.T) {
+	h := apptest.New(t)
+	h.Cache.Fail(errors.New("cache is down"))
+	h.Push(apptest.Tick("Exchange3", domain.SOLUSDT, 150))
+
+	var got apptest.Metric
+	if code := h.Get("/prices/latest/Exchange3/SOLUSDT", &got); code != http.StatusOK {
+		t.Fatalf("status %d, want %d", code, http.StatusOK)
+	}
+	if got.Price != 150 {
+		t.Errorf("price = %v, want 150", got.Price)
+	}
+}
+
+func TestLatestPriceNotFound(t *testing.T) {
+	h := apptest.New(t)
+
+	var got apptest.Message
+	if code := h.Get("/prices/latest/Exchange1/ETHUSDT", &got); code != http.StatusNotFound {
+		t.Fatalf("status %d, want %d", code, http.StatusNotFound)
+	}
+	if got.Message != domain.ErrLatestPriceNotFound.Error() {
+		t.Errorf("message = %q, want %q", got.Message, domain.ErrLatestPriceNotFound.Error())
+	}
+}
+
+func TestMetricsCombineStoredAndBufferedData(t *testing.T) {
+	h := apptest.New(t)
+	storeAggregate(h, domain.BTCUSDT, time.Now().Add(-time.Hour), 100, 90, 110)
+	h.Push(
+		apptest.Tick("Exchange1", domain.BTCUSDT, 80),
+		apptest.Tick("Exchange1", domain.BTCUSDT, 320),
+	)
+
+	tests := []struct {
+		path  string
+		price float64
+	}{
+		{"/prices/highest/Exchange1/BTCUSDT", 320},
+		{"/prices/highest/BTCUSDT", 320},
+		{"/prices/highest/Exchange2/BTCUSDT", 110},
+		{"/prices/lowest/Exchange1/BTCUSDT", 80},
+		{"/prices/lowest/BTCUSDT", 80},
+		{"/prices/lowest/Exchange2/BTCUSDT", 90},
+		// Weighted by ticks, two stored at 100 and two buffered at 80 and 320
+		{"/prices/average/Exchange1/BTCUSDT", 150},
+		{"/prices/average/BTCUSDT", 150},
+		{"/prices/average/Exchange2/BTCUSDT", 100},
+	}
+	for _, tt := range tests {
+		var got apptest.Metric
+		if code := h.Get(tt.path, &got); code != http.StatusOK {
+			t.Fatalf("GET %s: status %d, want %d", tt.path, code, http.StatusOK)
+		}
+		if got.Price != tt.price {
+			t.Errorf("GET %s: price = %v, want %v", tt.path, got.Price, tt.price)
+		}
+	}
+}
+
+func TestMetricsWithPeriod(t *testing.T) {
+	h := apptest.New(t)
+	storeAggregate(h, domain.TONUSDT, time.Now().Add(-2*time.Hour), 5, 1, 9)
+	storeAggregate(h, domain.TONUSDT, time.Now().Add(-time.Minute), 5, 4, 6)
+	h.Push(
+		apptest.Tick("Exchange2", domain.TONUSDT, 4.5),
+		apptest.Tick("Exchange2", domain.TONUSDT, 5.5),
+	)
+
+	tests := []struct {
+		path  string
+		price float64
+	}{
+		{"/prices/highest/Exchange2/TONUSDT?period=5m", 6},
+		{"/prices/highest/Exchange2/TONUSDT?period=3h", 9},
+		{"/prices/highest/TONUSDT?period=5m", 6},
+		{"/prices/lowest/Exchange2/TONUSDT?period=5m", 4},
+		{"/prices/lowest/Exchange2/TONUSDT?period=3h", 1},
+		{"/prices/lowest/TONUSDT?period=5m", 4},
+		{"/prices/average/Exchange2/TONUSDT?period=5m", 5},
+	}
+	for _, tt := range tests {
+		var got apptest.Metric
+		if code := h.Get(tt.path, &got); code != http.StatusOK {
+			t.Fatalf("GET %s: status %d, want %d", tt.path, code, http.StatusOK)
+		}
+		if got.Price != tt.price {
+			t.Errorf("GET %s: price = %v, want %v", tt.path, got.Price, tt.price)
+		}
+	}
+}
+
+func TestMetricErrors(t *testing.T) {
+	h := apptest.New(t)
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/prices/median/BTCUSDT", http.StatusBadRequest},
+		{"/prices/median/Exchange1/BTCUSDT", http.StatusBadRequest},
+		{"/prices/latest/Exchange9/BTCUSDT", http.StatusBadRequest},
+		{"/prices/latest/XRPUSDT", http.StatusBadRequest},
+		{"/prices/average/All/BTCUSDT?period=1m", http.StatusBadRequest},
+		{"/prices/highest/Exchange1/BTCUSDT?period=soon", http.StatusBadRequest},
+		{"/prices/highest/Exchange1/BTCUSDT", http.StatusNotFound},
+		{"/prices/lowest/DOGEUSDT", http.StatusNotFound},
+		{"/prices/average/Exchange1/BTCUSDT?period=1m", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		var got apptest.Message
+		if code := h.Get(tt.path, &got); code != tt.code {
+			t.Errorf("GET %s: status %d, want %d (%s)", tt.path, code, tt.code, got.Message)
+		}
+	}
+}
+
+func TestMetricDatabaseFailure(t *testing.T) {
+	h := apptest.New(t)
+	h.DB.Fail(errors.New("database is down"))
+
+	for _, path := range []string{
+		"/prices/highest/Exchange1/BTCUSDT",
+		"/prices/lowest/BTCUSDT",
+		"/prices/average/Exchange1/BTCUSDT",
+		"/prices/latest/Exchange1/BTCUSDT",
+	} {
+		var got apptest.Message
+		if code := h.Get(path, &got); code != http.StatusInternalServerError {
+			t.Errorf("GET %s: status %d, want %d", path, code, http.StatusInternalServerError)
+		}
+	}
+}
+
+func TestFreshness(t *testing.T) {
+	h := apptest.New(t)
+	domain.StaleThresholds = map[string]time.Duration{domain.DOGEUSDT: 50 * time.Millisecond}
+	storeAggregate(h, domain.ETHUSDT, time.Now().Add(-time.Hour), 3000, 2900, 3100)
+	h.Push(
+		apptest.Tick("Exchange1", domain.BTCUSDT, 60000),
+		apptest.Tick("Exchange1", domain.DOGEUSDT, 0.15),
+	)
+	time.Sleep(100 * time.Millisecond)
+
+	tests := []struct {
+		path       string
+		stale      bool
+		ageUnknown bool
+	}{
+		{"/prices/latest/Exchange1/BTCUSDT", false, false},
+		{"/prices/highest/BTCUSDT", false, false},
+		{"/prices/latest/Exchange1/DOGEUSDT", true, false},
+		{"/prices/average/Exchange1/DOGEUSDT?period=1m", true, false},
+		// Stored, but no tick seen since startup
+		{"/prices/highest/Exchange2/ETHUSDT", true, true},
+	}
+	for _, tt := range tests {
+		var got apptest.Metric
+		if code := h.Get(tt.path, &got); code != http.StatusOK {
+			t.Fatalf("GET %s: status %d, want %d", tt.path, code, http.StatusOK)
+		}
+		if got.Stale != tt.stale || (got.AgeMs == nil) != tt.ageUnknown {
+			t.Errorf("GET %s: stale = %v, age = %v, want stale = %v, age unknown = %v", tt.path, got.Stale, got.AgeMs, tt.stale, tt.ageUnknown)
+		}
+	}
+}
+
+func TestStalePriceRefused(t *testing.T) {
+	h := apptest.New(t)
+	domain.StaleThreshold = 50 * time.Millisecond
+	h.Push(apptest.Tick("Exchange3", domain.SOLUSDT, 150))
+
+	domain.StaleAction = domain.StaleUnavailable
+	if code := h.Get("/prices/latest/Exchange3/SOLUSDT", nil); code != http.StatusOK {
+		t.Fatalf("fresh price: status %d, want %d", code, http.StatusOK)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	var got apptest.Message
+	if code := h.Get("/prices/latest/Exchange3/SOLUSDT", &got); code != http.StatusServiceUnavailable {
+		t.Errorf("status %d, want %d", code, http.StatusServiceUnavailable)
+	}
+	if got.Message != domain.ErrStalePrice.Error() {
+		t.Errorf("message = %q, want %q", got.Message, domain.ErrStalePrice.Error())
+	}
+
+	domain.StaleAction = domain.StaleNotFound
+	if code := h.Get("/prices/lowest/SOLUSDT", nil); code != http.StatusNotFound {
+		t.Errorf("status %d, want %d", code, http.StatusNotFound)
+	}
+}
+
+func TestRejectedTicksAreNotAggregated(t *testing.T) {
+	h := apptest.New(t)
+	h.Push(
+		apptest.Tick("Exchange1", domain.ETHUSDT, 3000),
+		apptest.Tick("Exchange2", domain.ETHUSDT, 3010),
+		// Far off the other exchanges, then invalid
+		apptest.Tick("Exchange3", domain.ETHUSDT, 30000),
+		apptest.Tick("Exchange3", domain.ETHUSDT, -1),
+		apptest.Tick("Exchange3", domain.ETHUSDT, 3020),
+	)
+
+	tests := []struct {
+		path  string
+		price float64
+	}{
+		{"/prices/highest/ETHUSDT", 3020},
+		{"/prices/lowest/ETHUSDT", 3000},
+		{"/prices/highest/Exchange3/ETHUSDT", 3020},
+		{"/prices/lowest/Exchange3/ETHUSDT", 3020},
+	}
+	for _, tt := range tests {
+		var got apptest.Metric
+		if code := h.Get(tt.path, &got); code != http.StatusOK {
+			t.Fatalf("GET %s: status %d, want %d", tt.path, code, http.StatusOK)
+		}
+		if got.Price != tt.price {
+			t.Errorf("GET %s: price = %v, want %v", tt.path, got.Price, tt.price)
+		}
+	}
+}
+
+func TestCandlesInterval(t *testing.T) {
+	h := apptest.New(t)
+	h.Push(apptest.Tick("Exchange1", domain.BTCUSDT, 60000))
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		// The harness aggregates day long windows
+		{"/candles/Exchange1/BTCUSDT", "24h"},
+		{"/candles/Exchange1/BTCUSDT?interval=1440m", "1440m"},
+	}
+	for _, tt := range tests {
+		var got struct {
+			Interval string `json:"interval"`
+		}
+		if code := h.Get(tt.path, &got); code != http.StatusOK {
+			t.Fatalf("GET %s: status %d, want %d", tt.path, code, http.StatusOK)
+		}
+		if got.Interval != tt.want {
+			t.Errorf("GET %s: interval %q, want %q", tt.path, got.Interval, tt.want)
+		}
+	}
+}
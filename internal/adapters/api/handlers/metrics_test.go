@@ -0,0 +1,37 @@
+package handlers_test
+
+import (
+	"marketflow/internal/apptest"
+	"marketflow/internal/domain"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	h := apptest.New(t)
+	h.Push(apptest.Tick("Exchange1", domain.DOGEUSDT, 0.15))
+
+	h.Get("/prices/latest/Exchange1/DOGEUSDT", nil)
+	h.Get("/prices/latest/Exchange2/DOGEUSDT", nil)
+	h.Get("/nowhere", nil)
+
+	code, body := h.Raw(http.MethodGet, "/metrics")
+	if code != http.StatusOK {
+		t.Fatalf("status %d, want %d", code, http.StatusOK)
+	}
+
+	for _, want := range []string{
+		`marketflow_ticks_received_total{exchange="Exchange1",symbol="DOGEUSDT"}`,
+		`marketflow_fanin_batch_size_count`,
+		`marketflow_cache_lookups_total{result="hit"}`,
+		`marketflow_cache_lookups_total{result="miss"}`,
+		`marketflow_http_request_duration_seconds_count{code="200",method="GET",route="GET /prices/{metric}/{exchange}/{symbol}"}`,
+		`marketflow_http_request_duration_seconds_count{code="404",method="GET",route="unmatched"}`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics lack %s", want)
+		}
+	}
+}
@@ -19,7 +19,13 @@ func NewSwitchModeHandler(serv domain.DataModeService) *ModeHandler {
 // Core handler for switching datafetcher mode
 func (h *ModeHandler) SwitchMode(w http.ResponseWriter, r *http.Request) {
 	mode := r.PathValue("mode")
-	if code, err := h.serv.SwitchMode(mode); err != nil {
+
+	options := make(map[string]string)
+	for key, values := range r.URL.Query() {
+		options[key] = values[0]
+	}
+
+	if code, err := h.serv.SwitchMode(mode, options); err != nil {
 		logger.Error("Failed to switch mode", "message", err.Error())
 		utils.SendMsg(w, code, err.Error())
 		return
@@ -0,0 +1,137 @@
+package handlers_test
+
+import (
+	"marketflow/internal/apptest"
+	"marketflow/internal/domain"
+	"marketflow/pkg/fakeexchange"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// Points the scenario directory at the scenarios of the repository until the test ends
+func useScenarios(t *testing.T) {
+	dir := domain.ScenarioDir
+	t.Cleanup(func() { domain.ScenarioDir = dir })
+	domain.ScenarioDir = "../../../../scenarios"
+}
+
+func TestSwitchModeErrors(t *testing.T) {
+	h := apptest.New(t)
+	useScenarios(t)
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/mode/test", http.StatusBadRequest},
+		{"/mode/paper", http.StatusBadRequest},
+		{"/mode/replay", http.StatusBadRequest},
+		{"/mode/replay?source=db&from=yesterday&to=today", http.StatusBadRequest},
+		{"/mode/replay?source=missing.jsonl", http.StatusBadRequest},
+		{"/mode/replay?source=db&from=2024-01-01T00:00:00Z&to=2024-01-02T00:00:00Z&speed=fast", http.StatusBadRequest},
+		{"/mode/test?scenario=missing", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		var got apptest.Message
+		if code := h.Post(tt.path, &got); code != tt.code {
+			t.Errorf("POST %s: status %d, want %d (%s)", tt.path, code, tt.code, got.Message)
+		}
+	}
+
+	// Failed switches keep the running fetcher
+	if mode := h.Service.Datafetcher.Mode(); mode != domain.ModeTest {
+		t.Errorf("mode = %s, want %s", mode, domain.ModeTest)
+	}
+}
+
+func TestSwitchToScenario(t *testing.T) {
+	h := apptest.New(t)
+	useScenarios(t)
+
+	var got apptest.Message
+	if code := h.Post("/mode/test?scenario=spike", &got); code != http.StatusOK {
+		t.Fatalf("status %d, want %d (%s)", code, http.StatusOK, got.Message)
+	}
+	if got.Message != "Datafetcher mode switched to test" {
+		t.Errorf("message = %q", got.Message)
+	}
+
+	// The pushed ticks are gone with the old fetcher, the scenario feeds every exchange
+	h.Eventually(func() bool {
+		return h.Get("/prices/latest/Exchange3/BTCUSDT", nil) == http.StatusOK
+	})
+}
+
+func TestSwitchToReplayFromDatabase(t *testing.T) {
+	h := apptest.New(t)
+
+	from := time.Now().Add(-time.Second)
+	h.DB.Record([]domain.Data{
+		apptest.Tick("Exchange1", domain.ETHUSDT, 3000),
+		apptest.Tick("Exchange2", domain.ETHUSDT, 3010),
+	})
+	to := time.Now().Add(time.Second)
+
+	query := url.Values{
+		"source": {"db"},
+		"from":   {from.UTC().Format(time.RFC3339)},
+		"to":     {to.UTC().Format(time.RFC3339)},
+		"speed":  {"max"},
+	}
+	var msg apptest.Message
+	if code := h.Post("/mode/replay?"+query.Encode(), &msg); code != http.StatusOK {
+		t.Fatalf("status %d, want %d (%s)", code, http.StatusOK, msg.Message)
+	}
+	if mode := h.Service.Datafetcher.Mode(); mode != domain.ModeReplay {
+		t.Fatalf("mode = %s, want %s", mode, domain.ModeReplay)
+	}
+
+	var got apptest.Metric
+	h.Eventually(func() bool {
+		return h.Get("/prices/latest/Exchange2/ETHUSDT", &got) == http.StatusOK
+	})
+	if got.Price != 3010 {
+		t.Errorf("price = %v, want 3010", got.Price)
+	}
+
+	// A replay can always be restarted
+	if code := h.Post("/mode/replay?"+query.Encode(), &msg); code != http.StatusOK {
+		t.Errorf("restart: status %d, want %d (%s)", code, http.StatusOK, msg.Message)
+	}
+}
+
+func TestSwitchToLive(t *testing.T) {
+	h := apptest.New(t)
+
+	exchanges := make([]*fakeexchange.Server, len(apptest.Exchanges))
+	entries := ""
+	for i, name := range apptest.Exchanges {
+		exchanges[i] = fakeexchange.New(fakeexchange.Config{Addr: "127.0.0.1:0", Rate: 200, Seed: int64(i + 1)})
+		if err := exchanges[i].Start(); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { exchanges[i].Close() })
+
+		if i > 0 {
+			entries += ","
+		}
+		entries += name + "=" + exchanges[i].Addr()
+	}
+	t.Setenv("EXCHANGES", entries)
+
+	var msg apptest.Message
+	if code := h.Post("/mode/live", &msg); code != http.StatusOK {
+		t.Fatalf("status %d, want %d (%s)", code, http.StatusOK, msg.Message)
+	}
+	if code := h.Post("/mode/live", &msg); code != http.StatusBadRequest {
+		t.Errorf("second switch: status %d, want %d", code, http.StatusBadRequest)
+	}
+
+	for _, name := range apptest.Exchanges {
+		h.Eventually(func() bool {
+			return h.Get("/prices/latest/"+name+"/BTCUSDT", nil) == http.StatusOK
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"marketflow/internal/adapters/stream"
+	"marketflow/internal/domain/utils"
+	"marketflow/pkg/logger"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Interval of SSE comments keeping idle connections open through proxies
+const keepAliveInterval = 15 * time.Second
+
+type StreamHandler struct {
+	hub *stream.Hub
+}
+
+func NewStreamHandler(hub *stream.Hub) *StreamHandler {
+	return &StreamHandler{hub: hub}
+}
+
+// Core handler for streaming price updates as Server-Sent Events
+func (h *StreamHandler) StreamPrices(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		logger.Error("Streaming is not supported by the response writer")
+		utils.SendMsg(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	symbols := splitList(r.URL.Query().Get("symbols"))
+	for _, symbol := range symbols {
+		if err := utils.CheckSymbolName(symbol); err != nil {
+			utils.SendMsg(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	exchanges := splitList(r.URL.Query().Get("exchanges"))
+	for _, exchange := range exchanges {
+		if err := utils.CheckExchangeName(exchange); err != nil {
+			utils.SendMsg(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	client := h.hub.Connect()
+	defer h.hub.Disconnect(client)
+	client.Subscribe(stream.ChannelPrices, symbols, exchanges)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	logger.Info("Stream client connected", "symbols", symbols, "exchanges", exchanges)
+	defer logger.Info("Stream client disconnected", "symbols", symbols, "exchanges", exchanges)
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-client.Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case event := <-client.Events():
+			payload, err := json.Marshal(event.Data)
+			if err != nil {
+				logger.Error("Failed to marshal stream update", "error", err.Error())
+				continue
+			}
+
+			if _, err := fmt.Fprintf(w, "event: price\ndata: %s\n\n", payload); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// Splits a comma separated query value, skipping empty items
+func splitList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
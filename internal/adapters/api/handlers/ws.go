@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"marketflow/internal/adapters/stream"
+	"marketflow/internal/domain/utils"
+	"marketflow/pkg/logger"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Time allowed to write a message to the peer
+	wsWriteWait = 10 * time.Second
+	// Time allowed to read the next pong message from the peer
+	wsPongWait = 60 * time.Second
+	// Pings are sent with this period, it must be less than wsPongWait
+	wsPingPeriod = 30 * time.Second
+	// Maximum message size allowed from the peer
+	wsMaxMessageSize = 4096
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// Message sent by the client
+type wsRequest struct {
+	Type      string   `json:"type"` // subscribe or unsubscribe
+	Channel   string   `json:"channel"`
+	Symbols   []string `json:"symbols,omitempty"`
+	Exchanges []string `json:"exchanges,omitempty"`
+}
+
+// Message sent by the server
+type wsResponse struct {
+	Type      string   `json:"type"` // update, subscribed, unsubscribed or error
+	Channel   string   `json:"channel,omitempty"`
+	Symbols   []string `json:"symbols,omitempty"`
+	Exchanges []string `json:"exchanges,omitempty"`
+	Data      any      `json:"data,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// Core handler for the bidirectional WebSocket subscription API
+func (h *StreamHandler) WebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already replied to the client
+		logger.Error("Failed to upgrade websocket connection", "error", err.Error())
+		return
+	}
+	defer conn.Close()
+
+	client := h.hub.Connect()
+	defer h.hub.Disconnect(client)
+
+	logger.Info("Websocket client connected", "remote", r.RemoteAddr)
+	defer logger.Info("Websocket client disconnected", "remote", r.RemoteAddr)
+
+	// Replies of the reader go through the writer, a connection supports one concurrent writer
+	replies := make(chan wsResponse, 16)
+	readerDone := make(chan struct{})
+	go h.readRequests(conn, client, replies, readerDone)
+
+	ping := time.NewTicker(wsPingPeriod)
+	defer ping.Stop()
+
+	for {
+		var msg wsResponse
+
+		select {
+		case <-readerDone:
+			return
+		case <-client.Done():
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server is shutting down"))
+			return
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+			continue
+		case msg = <-replies:
+		case event := <-client.Events():
+			msg = wsResponse{Type: "update", Channel: event.Channel, Data: event.Data}
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		if err := conn.WriteJSON(msg); err != nil {
+			logger.Debug("Failed to write websocket message", "error", err.Error())
+			return
+		}
+	}
+}
+
+// Reads subscription requests until the connection is closed or stops answering pings
+func (h *StreamHandler) readRequests(conn *websocket.Conn, client *stream.Client, replies chan<- wsResponse, done chan<- struct{}) {
+	defer close(done)
+
+	conn.SetReadLimit(wsMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, payload, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				logger.Debug("Websocket connection closed unexpectedly", "error", err.Error())
+			}
+			return
+		}
+
+		var req wsRequest
+		if err := json.Unmarshal(payload, &req); err != nil {
+			// A malformed message does not break the connection
+			if !sendReply(replies, client, wsResponse{Type: "error", Error: "invalid message: " + err.Error()}) {
+				return
+			}
+			continue
+		}
+
+		reply := wsResponse{Type: req.Type + "d", Channel: req.Channel, Symbols: req.Symbols, Exchanges: req.Exchanges}
+		if err := validateRequest(req); err != nil {
+			reply = wsResponse{Type: "error", Error: err.Error()}
+		} else if req.Type == "subscribe" {
+			client.Subscribe(req.Channel, req.Symbols, req.Exchanges)
+		} else {
+			client.Unsubscribe(req.Channel, req.Symbols, req.Exchanges)
+		}
+
+		if !sendReply(replies, client, reply) {
+			return
+		}
+	}
+}
+
+func sendReply(replies chan<- wsResponse, client *stream.Client, reply wsResponse) bool {
+	select {
+	case replies <- reply:
+		return true
+	case <-client.Done():
+		return false
+	}
+}
+
+func validateRequest(req wsRequest) error {
+	if req.Type != "subscribe" && req.Type != "unsubscribe" {
+		return errors.New("message type is invalid, must be (subscribe, unsubscribe)")
+	}
+
+	if !slices.Contains(stream.Channels, req.Channel) {
+		return errors.New("channel is invalid, must be (prices, aggregates)")
+	}
+
+	for _, symbol := range req.Symbols {
+		if err := utils.CheckSymbolName(symbol); err != nil {
+			return err
+		}
+	}
+
+	for _, exchange := range req.Exchanges {
+		if err := utils.CheckExchangeName(exchange); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -11,8 +11,9 @@ import (
 // Fetches the average price for a specific exchange and symbol
 func (serv *DataModeServiceImp) AveragePrice(exchange, symbol string) (domain.Data, int, error) {
 	var (
-		data domain.Data
-		err  error
+		data  domain.Data
+		ticks int64
+		err   error
 	)
 
 	if err := utils.CheckExchangeName(exchange); err != nil {
@@ -25,12 +26,12 @@ func (serv *DataModeServiceImp) AveragePrice(exchange, symbol string) (domain.Da
 
 	switch exchange {
 	case "All":
-		data, err = serv.DB.AveragePriceByAllExchanges(symbol)
+		data, ticks, err = serv.DB.AveragePriceByAllExchanges(symbol)
 		if err != nil {
 			return data, http.StatusInternalServerError, err
 		}
 	default:
-		data, err = serv.DB.AveragePriceByExchange(exchange, symbol)
+		data, ticks, err = serv.DB.AveragePriceByExchange(exchange, symbol)
 		if err != nil {
 			return data, http.StatusInternalServerError, err
 		}
@@ -44,9 +45,7 @@ func (serv *DataModeServiceImp) AveragePrice(exchange, symbol string) (domain.Da
 	data.Timestamp = time.Now().UnixMilli()
 	key := exchange + " " + symbol
 	if avg, ok := merged[key]; ok {
-		if avg.Average_price != 0 {
-			data.Price = (avg.Average_price + data.Price) / 2
-		}
+		data.Price = weightedAverage(data.Price, ticks, avg)
 	} else {
 		logger.Warn("Aggregated data not found for key", "key", key)
 	}
@@ -61,8 +60,9 @@ func (serv *DataModeServiceImp) AveragePrice(exchange, symbol string) (domain.Da
 // Fetches the average price for a specific exchange and symbol over a given period
 func (serv *DataModeServiceImp) AveragePriceWithPeriod(exchange, symbol, period string) (domain.Data, int, error) {
 	var (
-		data domain.Data
-		err  error
+		data  domain.Data
+		ticks int64
+		err   error
 	)
 
 	if err := utils.CheckExchangeName(exchange); err != nil {
@@ -83,7 +83,7 @@ func (serv *DataModeServiceImp) AveragePriceWithPeriod(exchange, symbol, period
 	}
 	startTime := time.Now()
 
-	data, err = serv.DB.AveragePriceWithDuration(exchange, symbol, startTime, duration)
+	data, ticks, err = serv.DB.AveragePriceWithDuration(exchange, symbol, startTime, duration)
 	if err != nil {
 		return data, http.StatusInternalServerError, err
 	}
@@ -95,9 +95,7 @@ func (serv *DataModeServiceImp) AveragePriceWithPeriod(exchange, symbol, period
 
 	key := exchange + " " + symbol
 	if agg, ok := merged[key]; ok {
-		if agg.Average_price != 0 {
-			data.Price = (agg.Average_price + data.Price) / 2
-		}
+		data.Price = weightedAverage(data.Price, ticks, agg)
 	} else {
 		logger.Warn("Aggregated data not found for key", "key", key)
 	}
@@ -108,3 +106,12 @@ func (serv *DataModeServiceImp) AveragePriceWithPeriod(exchange, symbol, period
 
 	return data, http.StatusOK, nil
 }
+
+// Average of the stored and the buffered ticks, each weighted by its tick count
+func weightedAverage(stored float64, storedTicks int64, buffered domain.ExchangeData) float64 {
+	ticks := storedTicks + buffered.Tick_count
+	if ticks == 0 {
+		return stored
+	}
+	return (stored*float64(storedTicks) + buffered.Price_sum) / float64(ticks)
+}
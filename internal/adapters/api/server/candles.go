@@ -0,0 +1,125 @@
+package server
+
+import (
+	"marketflow/internal/domain"
+	"marketflow/internal/domain/utils"
+	"marketflow/pkg/logger"
+	"net/http"
+	"time"
+)
+
+// Upper bound of candles returned by a single request
+const maxCandles = 1000
+
+// Number of candles returned when the range start is not given
+const defaultCandles = 100
+
+// Fetches OHLC candles of the given interval for a specific exchange and symbol within [from, to)
+func (serv *DataModeServiceImp) Candles(exchange, symbol, interval, from, to string) ([]domain.Candle, int, error) {
+	if err := utils.CheckExchangeName(exchange); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if err := utils.CheckSymbolName(symbol); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	step, err := parseInterval(interval)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	end := time.Now()
+	if to != "" {
+		if end, err = time.Parse(time.RFC3339, to); err != nil {
+			return nil, http.StatusBadRequest, domain.ErrInvalidTimeRange
+		}
+	}
+
+	start := end.Add(-defaultCandles * step)
+	if from != "" {
+		if start, err = time.Parse(time.RFC3339, from); err != nil {
+			return nil, http.StatusBadRequest, domain.ErrInvalidTimeRange
+		}
+	}
+
+	if !start.Before(end) {
+		return nil, http.StatusBadRequest, domain.ErrInvalidTimeRange
+	}
+
+	// The first candle is always a whole one
+	start = start.Truncate(step)
+	if end.Sub(start)/step > maxCandles {
+		return nil, http.StatusBadRequest, domain.ErrTooManyCandles
+	}
+
+	candles, err := serv.DB.Candles(exchange, symbol, step, start, end)
+	if err != nil {
+		logger.Error("Failed to get candles", "exchange", exchange, "symbol", symbol, "error", err.Error())
+		return nil, http.StatusInternalServerError, err
+	}
+
+	// The open windows are not stored yet, so we take them from the DataBuffer
+	serv.mu.Lock()
+	windows := mergeWindows(serv.DataBuffer)
+	serv.mu.Unlock()
+
+	for _, w := range windows {
+		if agg, ok := w.rows[exchange+" "+symbol]; ok && agg.Tick_count > 0 && !w.start.Before(start) && w.start.Before(end) {
+			candles = appendCandle(candles, domain.Candle{
+				Exchange: exchange,
+				Symbol:   symbol,
+				OpenTime: w.start.Truncate(step),
+				Open:     agg.Open_price,
+				High:     agg.Max_price,
+				Low:      agg.Min_price,
+				Close:    agg.Close_price,
+				Ticks:    agg.Tick_count,
+			})
+		}
+	}
+
+	if len(candles) == 0 {
+		return nil, http.StatusNotFound, domain.ErrCandlesNotFound
+	}
+
+	return candles, http.StatusOK, nil
+}
+
+// Parses a series interval, it has to be built from whole aggregation windows
+func parseInterval(interval string) (time.Duration, error) {
+	if interval == "" {
+		return domain.AggregationWindow, nil
+	}
+
+	step, err := time.ParseDuration(interval)
+	if err != nil {
+		return 0, domain.ErrInvalidInterval
+	}
+
+	if step < domain.AggregationWindow || step%domain.AggregationWindow != 0 || step > 24*time.Hour || (24*time.Hour)%step != 0 {
+		return 0, domain.ErrInvalidInterval
+	}
+
+	return step, nil
+}
+
+// Appends the candle to the series, merging it into the last one if they share the open time
+func appendCandle(candles []domain.Candle, candle domain.Candle) []domain.Candle {
+	if len(candles) == 0 {
+		return append(candles, candle)
+	}
+
+	last := &candles[len(candles)-1]
+	switch {
+	case last.OpenTime.Equal(candle.OpenTime):
+		last.High = max(last.High, candle.High)
+		last.Low = min(last.Low, candle.Low)
+		last.Close = candle.Close
+		last.Ticks += candle.Ticks
+	case last.OpenTime.Before(candle.OpenTime):
+		candles = append(candles, candle)
+	}
+
+	return candles
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"marketflow/internal/domain"
+	"net/http"
+	"time"
+)
+
+// Remembers when every exchange and symbol of the batch was last received
+func (serv *DataModeServiceImp) markSeen(rawData []domain.Data) {
+	now := time.Now()
+
+	serv.mu.Lock()
+	defer serv.mu.Unlock()
+	for _, data := range rawData {
+		serv.seen[data.ExchangeName+" "+data.Symbol] = now
+		serv.seen["All "+data.Symbol] = now
+	}
+}
+
+// Freshness of the feed of the exchange and symbol, measured from the last tick received.
+// Without one since startup it is measured from fallback, a unix millisecond timestamp, if it is set.
+// A stale price is refused with the configured status unless stale prices are served.
+func (serv *DataModeServiceImp) Freshness(exchange, symbol string, fallback int64) (domain.Freshness, int, error) {
+	serv.mu.Lock()
+	seen := serv.seen[exchange+" "+symbol]
+	serv.mu.Unlock()
+
+	if seen.IsZero() && fallback != 0 {
+		seen = time.UnixMilli(fallback)
+	}
+
+	freshness := domain.Freshness{Stale: true}
+	if !seen.IsZero() {
+		age := time.Since(seen)
+		ageMs := age.Milliseconds()
+		freshness.AgeMs = &ageMs
+		freshness.Stale = age > domain.StaleThresholdFor(symbol)
+	}
+
+	if freshness.Stale {
+		switch domain.StaleAction {
+		case domain.StaleUnavailable:
+			return freshness, http.StatusServiceUnavailable, domain.ErrStalePrice
+		case domain.StaleNotFound:
+			return freshness, http.StatusNotFound, domain.ErrStalePrice
+		}
+	}
+	return freshness, http.StatusOK, nil
+}
@@ -3,30 +3,78 @@ package server
 import (
 	"marketflow/internal/domain"
 	"marketflow/pkg/logger"
+	"time"
 )
 
-// Services health checking logic
-func (serv *DataModeServiceImp) CheckHealth() []domain.ConnMsg {
-	data := make([]domain.ConnMsg, 0)
+// Services health checking logic. The service is ready while the database is reachable and, for fetchers
+// with separate exchange connections, at least one exchange is connected. Anything else failing degrades it.
+func (serv *DataModeServiceImp) CheckHealth() domain.HealthReport {
+	serv.mu.Lock()
+	fetcher := serv.Datafetcher
+	flushes := serv.flushes
+	report := domain.HealthReport{
+		Mode:       fetcher.Mode(),
+		BufferSize: len(serv.DataBuffer),
+	}
+	serv.mu.Unlock()
 
-	if err := serv.Datafetcher.CheckHealth(); err != nil {
+	degraded := false
+	if err := fetcher.CheckHealth(); err != nil {
 		logger.Error("Cathed error from Datafetcher health: ", "error", err.Error())
-		data = append(data, domain.ConnMsg{Connection: "Datafetcher", Status: err.Error()})
+		report.FetcherError = err.Error()
+		degraded = true
+	}
+
+	connected := true
+	if reporter, ok := fetcher.(domain.ExchangeHealthReporter); ok {
+		report.Exchanges = reporter.ExchangeHealth()
+		connected = false
+		for _, exch := range report.Exchanges {
+			connected = connected || exch.State == domain.ConnConnected
+		}
+	}
+
+	report.Database = storeHealth(serv.DB.CheckHealth(), flushes.db, flushes.dbErr)
+	if report.Database.Error != "" {
+		logger.Info("Cathed error from Database health: ", "error", report.Database.Error)
 	}
 
-	if err := serv.DB.CheckHealth(); err != nil {
-		logger.Info("Cathed error from Database health: ", "error", err.Error())
-		data = append(data, domain.ConnMsg{Connection: "Database", Status: "unhealthy"})
+	report.Cache = storeHealth(serv.Cache.CheckHealth(), flushes.cache, flushes.cacheErr)
+	if report.Cache.Error != "" {
+		logger.Info("Cathed error from Cache health: ", "error", report.Cache.Error)
 	}
 
-	if err := serv.Cache.CheckHealth(); err != nil {
-		logger.Info("Cathed error from Cache health: ", "error", err.Error())
-		data = append(data, domain.ConnMsg{Connection: "Cache", Status: "unhealthy"})
+	spooled := false
+	if serv.Spool != nil {
+		spool := serv.Spool.Health()
+		report.Spool = &spool
+		spooled = spool.Records > 0
 	}
 
-	if len(data) == 0 {
-		data = append(data, domain.ConnMsg{Status: "all connections are healthy"})
+	report.Ready = connected && report.Database.Status == domain.HealthHealthy
+	switch {
+	case !report.Ready:
+		report.Status = domain.HealthUnhealthy
+	case degraded || spooled || report.Cache.Status != domain.HealthHealthy || report.Database.LastFlushError != "" || report.Cache.LastFlushError != "":
+		report.Status = domain.HealthDegraded
+	default:
+		report.Status = domain.HealthHealthy
 	}
 
-	return data
+	return report
+}
+
+func storeHealth(err error, lastFlush time.Time, flushErr error) domain.StoreHealth {
+	health := domain.StoreHealth{Status: domain.HealthHealthy}
+	if err != nil {
+		health.Status = domain.HealthUnhealthy
+		health.Error = err.Error()
+	}
+	if !lastFlush.IsZero() {
+		health.LastFlush = &lastFlush
+	}
+	if flushErr != nil {
+		health.LastFlushError = flushErr.Error()
+	}
+	return health
 }
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"marketflow/internal/domain"
+	"marketflow/internal/domain/utils"
+	"marketflow/pkg/logger"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultHistoryLimit = 500
+	maxHistoryLimit     = 5000
+)
+
+// Fetches a page of the stored aggregate series for a specific exchange and symbol within an absolute range
+func (serv *DataModeServiceImp) PriceHistory(exchange, symbol, from, to, step, limit, offset string) (domain.PriceHistory, int, error) {
+	history := domain.PriceHistory{
+		Exchange: exchange,
+		Symbol:   symbol,
+		Step:     step,
+	}
+
+	if err := utils.CheckExchangeName(exchange); err != nil {
+		return history, http.StatusBadRequest, err
+	}
+
+	if err := utils.CheckSymbolName(symbol); err != nil {
+		return history, http.StatusBadRequest, err
+	}
+
+	if from == "" || to == "" {
+		return history, http.StatusBadRequest, domain.ErrEmptyTimeRange
+	}
+
+	start, err := time.Parse(time.RFC3339, from)
+	if err != nil {
+		return history, http.StatusBadRequest, domain.ErrInvalidTimeRange
+	}
+
+	end, err := time.Parse(time.RFC3339, to)
+	if err != nil || !start.Before(end) {
+		return history, http.StatusBadRequest, domain.ErrInvalidTimeRange
+	}
+	history.From, history.To = start, end
+
+	var interval time.Duration
+	if step != "" {
+		if interval, err = parseInterval(step); err != nil {
+			return history, http.StatusBadRequest, err
+		}
+	}
+
+	pageSize, pageOffset := defaultHistoryLimit, 0
+	if limit != "" {
+		if pageSize, err = strconv.Atoi(limit); err != nil || pageSize < 1 || pageSize > maxHistoryLimit {
+			return history, http.StatusBadRequest, domain.ErrInvalidPagination
+		}
+	}
+	if offset != "" {
+		if pageOffset, err = strconv.Atoi(offset); err != nil || pageOffset < 0 {
+			return history, http.StatusBadRequest, domain.ErrInvalidPagination
+		}
+	}
+
+	// One extra row tells us whether there is a next page
+	points, err := serv.DB.PriceHistory(exchange, symbol, start, end, interval, pageSize+1, pageOffset)
+	if err != nil {
+		logger.Error("Failed to get price history", "exchange", exchange, "symbol", symbol, "error", err.Error())
+		return history, http.StatusInternalServerError, err
+	}
+
+	if len(points) > pageSize {
+		points = points[:pageSize]
+		next := pageOffset + pageSize
+		history.NextOffset = &next
+	}
+	history.Points = points
+
+	return history, http.StatusOK, nil
+}
@@ -1,9 +1,11 @@
 package server
 
 import (
+	"errors"
 	"marketflow/internal/domain"
 	"marketflow/internal/domain/utils"
 	"marketflow/pkg/logger"
+	"marketflow/pkg/metrics"
 	"net/http"
 )
 
@@ -26,6 +28,14 @@ func (serv *DataModeServiceImp) LatestData(exchange string, symbol string) (doma
 
 	// first we look for data in the cache
 	latest, err = serv.Cache.LatestData(exchange, symbol)
+	switch {
+	case err == nil:
+		metrics.CacheLookups.WithLabelValues(metrics.CacheHit).Inc()
+	case errors.Is(err, domain.ErrCacheMiss):
+		metrics.CacheLookups.WithLabelValues(metrics.CacheMiss).Inc()
+	default:
+		metrics.CacheLookups.WithLabelValues(metrics.CacheError).Inc()
+	}
 	if err != nil {
 		// If Redis is not available, se look for data in the DB
 		logger.Debug("Failed to get latest data from cache: ", "error", err.Error())
@@ -2,8 +2,11 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"marketflow/internal/adapters/exchange"
+	"marketflow/internal/adapters/recorder"
+	"marketflow/internal/adapters/stream"
 	"marketflow/internal/domain"
 	"marketflow/pkg/logger"
 	"net/http"
@@ -15,18 +18,34 @@ type DataModeServiceImp struct {
 	DataBuffer  []map[string]domain.ExchangeData
 	Datafetcher domain.DataFetcher
 	Cache       domain.CacheMemory
+	Hub         *stream.Hub
+	Recorder    *recorder.Recorder    // optional recorder of live exchange lines
+	Spool       domain.AggregateSpool // optional spool of aggregates the database could not take
 	cancel      context.CancelFunc
 	DB          domain.Database
+	flushes     flushStatus          // guarded by mu
+	seen        map[string]time.Time // last tick received by "exchange symbol" key, guarded by mu
+	closedUntil time.Time            // end of the last flushed window, guarded by mu
+	splitWindow time.Time            // start of the last window cut short by a final flush, guarded by mu
+	switchMu    sync.Mutex           // serializes mode switches and stopping
 	wg          sync.WaitGroup
 	mu          sync.Mutex
 }
 
+// Outcome of the last aggregated data flush into each store
+type flushStatus struct {
+	db, cache       time.Time
+	dbErr, cacheErr error
+}
+
 func NewDataFetcher(dataSource domain.DataFetcher, DataSaver domain.Database, Cache domain.CacheMemory) *DataModeServiceImp {
 	return &DataModeServiceImp{
 		Datafetcher: dataSource,
 		DB:          DataSaver,
 		Cache:       Cache,
+		Hub:         stream.NewHub(),
 		DataBuffer:  make([]map[string]domain.ExchangeData, 0),
+		seen:        make(map[string]time.Time),
 	}
 }
 
@@ -34,40 +53,112 @@ func NewDataFetcher(dataSource domain.DataFetcher, DataSaver domain.Database, Ca
 var _ (domain.DataModeService) = (*DataModeServiceImp)(nil)
 
 // Mode switch core logic
-func (serv *DataModeServiceImp) SwitchMode(mode string) (int, error) {
+func (serv *DataModeServiceImp) SwitchMode(mode string, options map[string]string) (int, error) {
+	serv.switchMu.Lock()
+	defer serv.switchMu.Unlock()
+
 	serv.mu.Lock()
-	defer serv.mu.Unlock()
+	current := serv.Datafetcher.Mode()
+	serv.mu.Unlock()
 
-	// Check if is current datafetcher mode equal to changing mode
-	if _, ok := serv.Datafetcher.(*exchange.LiveMode); (ok && mode == "live") || (!ok && mode == "test") {
+	// Check if is current datafetcher mode equal to changing mode, a replay or a test scenario can always be restarted
+	restartable := mode == domain.ModeReplay || (mode == domain.ModeTest && options["scenario"] != "")
+	if current == mode && !restartable {
 		return http.StatusBadRequest, fmt.Errorf("data mode is already switched to %s", mode)
 	}
 
+	var fetcher domain.DataFetcher
 	switch mode {
-	case "test":
-		serv.Datafetcher.Close()
-		serv.Datafetcher = exchange.NewTestModeFetcher()
-		if err := serv.ListenAndSave(); err != nil {
-			return http.StatusInternalServerError, err
+	case domain.ModeTest:
+		if name := options["scenario"]; name != "" {
+			scenario, err := exchange.LoadScenario(domain.ScenarioDir, name)
+			if errors.Is(err, domain.ErrScenarioNotFound) {
+				return http.StatusNotFound, err
+			}
+			if err != nil {
+				return http.StatusBadRequest, err
+			}
+			fetcher = exchange.NewScenarioTestModeFetcher(scenario)
+		} else {
+			fetcher = exchange.NewTestModeFetcher()
 		}
-	case "live":
-		serv.Datafetcher.Close()
-		serv.Datafetcher = exchange.NewLiveModeFetcher()
-		if err := serv.ListenAndSave(); err != nil {
-			return http.StatusInternalServerError, err
+	case domain.ModeLive:
+		fetcher = exchange.NewLiveModeFetcher(serv.lineRecorder())
+	case domain.ModeReplay:
+		replay, err := serv.newReplayFetcher(options)
+		if err != nil {
+			return http.StatusBadRequest, err
 		}
+		fetcher = replay
 	default:
 		return http.StatusBadRequest, domain.ErrInvalidModeVal
 	}
+
+	serv.stop()
+	serv.mu.Lock()
+	serv.Datafetcher = fetcher
+	serv.mu.Unlock()
+	if err := serv.ListenAndSave(); err != nil {
+		return http.StatusInternalServerError, err
+	}
 	return http.StatusOK, nil
 }
 
+// Avoids handing a nil *Recorder over as a non-nil interface
+func (serv *DataModeServiceImp) lineRecorder() domain.LineRecorder {
+	if serv.Recorder == nil {
+		return nil
+	}
+	return serv.Recorder
+}
+
+// Builds a replay fetcher from a file in the replay directory or from the raw tick store
+func (serv *DataModeServiceImp) newReplayFetcher(options map[string]string) (*exchange.ReplayMode, error) {
+	speed, err := exchange.ParseReplaySpeed(options["speed"])
+	if err != nil {
+		return nil, err
+	}
+
+	var source exchange.TickSource
+	switch options["source"] {
+	case "":
+		return nil, domain.ErrEmptyReplaySource
+	case "db":
+		from, err := time.Parse(time.RFC3339, options["from"])
+		if err != nil {
+			return nil, domain.ErrInvalidTimeRange
+		}
+		to, err := time.Parse(time.RFC3339, options["to"])
+		if err != nil || !from.Before(to) {
+			return nil, domain.ErrInvalidTimeRange
+		}
+		source = exchange.NewStoreTickSource(serv.DB, from, to)
+	default:
+		if source, err = exchange.NewFileTickSource(domain.ReplayDir, options["source"]); err != nil {
+			return nil, err
+		}
+	}
+
+	return exchange.NewReplayModeFetcher(source, speed), nil
+}
+
 // Goroutines stop logic
 func (serv *DataModeServiceImp) StopListening() {
-	serv.cancel()
+	serv.switchMu.Lock()
+	defer serv.switchMu.Unlock()
+
+	serv.stop()
+	logger.Info("Listen and save goroutine has been finished...")
+}
+
+// Stops the goroutines of the fetcher and flushes what they buffered, the collector returns once its channel is drained
+func (serv *DataModeServiceImp) stop() {
+	if serv.cancel != nil {
+		serv.cancel()
+	}
 	serv.Datafetcher.Close()
 	serv.wg.Wait()
-	logger.Info("Listen and save goroutine has been finished...")
+	serv.flushBuffer()
 }
 
 // Core logic: handle data retrieval, aggregation, and persistence for exchanges
@@ -82,7 +173,7 @@ func (serv *DataModeServiceImp) ListenAndSave() error {
 	serv.wg.Add(3)
 
 	go serv.listenAndSaveLatest(rawDataChan)
-	go serv.aggregateAndSaveEveryMinute(ctx)
+	go serv.aggregateAndSaveEveryWindow(ctx)
 	go serv.collectAggregatedData(ctx, aggregatedChan)
 
 	return nil
@@ -94,23 +185,27 @@ func (serv *DataModeServiceImp) listenAndSaveLatest(rawDataChan chan []domain.Da
 	serv.SaveLatestData(rawDataChan)
 }
 
-// Every minute aggregates buffered data and saves it
-func (serv *DataModeServiceImp) aggregateAndSaveEveryMinute(ctx context.Context) {
+// Flushes every window once the watermark, the wall clock minus the allowed lateness, passed its end
+func (serv *DataModeServiceImp) aggregateAndSaveEveryWindow(ctx context.Context) {
 	defer serv.wg.Done()
-	ticker := time.NewTicker(time.Minute)
-	defer ticker.Stop()
+	window := domain.AggregationWindow
+	lateness := domain.AllowedLateness
+
+	// Windows are aligned to the wall clock, so rows are bucketed the same way across restarts
+	untilNextFlush := func() time.Duration {
+		watermark := time.Now().Add(-lateness)
+		return time.Until(watermark.Truncate(window).Add(window + lateness))
+	}
+	timer := time.NewTimer(untilNextFlush())
+	defer timer.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
-			serv.mu.Lock()
-			merged := MergeAggregatedData(serv.DataBuffer)
-			serv.DB.SaveAggregatedData(merged)
-			serv.Cache.SaveAggregatedData(merged)
-			serv.DataBuffer = nil
-			serv.mu.Unlock()
+		case <-timer.C:
+			serv.flushClosedWindows(time.Now().Add(-lateness))
+			timer.Reset(untilNextFlush())
 		}
 	}
 }
@@ -123,26 +218,25 @@ func (serv *DataModeServiceImp) collectAggregatedData(ctx context.Context, aggre
 		select {
 		case <-ctx.Done():
 			for data := range aggregated {
-				serv.mu.Lock()
-				serv.DataBuffer = append(serv.DataBuffer, data)
-				logger.Debug("Received data", "buffer_size", len(serv.DataBuffer))
-				serv.mu.Unlock()
+				serv.bufferAggregates(data)
 			}
 			return
 		case data, ok := <-aggregated:
 			if !ok {
 				return
 			}
-			serv.mu.Lock()
-			serv.DataBuffer = append(serv.DataBuffer, data)
-			serv.mu.Unlock()
+			serv.bufferAggregates(data)
 		}
 	}
 }
 
-// Retrieves the latest data from the channel and stores it in both PostgreSQL and Redis
+// Retrieves the latest data from the channel, streams it to subscribers and stores it in both PostgreSQL and Redis
 func (serv *DataModeServiceImp) SaveLatestData(rawDataChan chan []domain.Data) {
 	for rawData := range rawDataChan {
+		serv.Hub.Publish(rawData)
+
+		serv.markSeen(rawData)
+
 		latestData := make(map[string]domain.Data)
 		for i := len(rawData) - 1; i >= 0; i-- {
 			if rawData[i].ExchangeName == "" || rawData[i].Symbol == "" {
@@ -181,20 +275,21 @@ func (serv *DataModeServiceImp) SaveLatestData(rawDataChan chan []domain.Data) {
 // Merges multiple aggregated exchange data entries into a single aggregated result
 func MergeAggregatedData(DataBuffer []map[string]domain.ExchangeData) map[string]domain.ExchangeData {
 	result := make(map[string]domain.ExchangeData)
-	sums := make(map[string]float64)
-	counts := make(map[string]int)
+	opened := make(map[string]time.Time)
 
 	for _, dataMap := range DataBuffer {
 		for key, val := range dataMap {
 			agg, exists := result[key]
 			if !exists {
 				agg = domain.ExchangeData{
-					Pair_name: val.Pair_name,
-					Exchange:  val.Exchange,
-					Min_price: val.Min_price,
-					Max_price: val.Max_price,
-					Timestamp: val.Timestamp,
+					Pair_name:  val.Pair_name,
+					Exchange:   val.Exchange,
+					Min_price:  val.Min_price,
+					Max_price:  val.Max_price,
+					Open_price: val.Open_price,
+					Timestamp:  val.Timestamp,
 				}
+				opened[key] = val.Timestamp
 			}
 
 			if val.Min_price < agg.Min_price {
@@ -204,21 +299,26 @@ func MergeAggregatedData(DataBuffer []map[string]domain.ExchangeData) map[string
 				agg.Max_price = val.Max_price
 			}
 
-			sums[key] += val.Average_price
-			counts[key]++
-
-			if val.Timestamp.After(agg.Timestamp) {
+			// Open and close follow the event time, aggregates with the same time keep their arrival order
+			if val.Timestamp.Before(opened[key]) {
+				agg.Open_price = val.Open_price
+				opened[key] = val.Timestamp
+			}
+			if !val.Timestamp.Before(agg.Timestamp) {
+				agg.Close_price = val.Close_price
 				agg.Timestamp = val.Timestamp
 			}
+			agg.Tick_count += val.Tick_count
+			agg.Price_sum += val.Price_sum
 
 			result[key] = agg
 		}
 	}
 
-	// Count average
+	// Weighted by tick count, so batches with more ticks count for more
 	for key, item := range result {
-		if count := counts[key]; count > 0 {
-			item.Average_price = sums[key] / float64(count)
+		if item.Tick_count > 0 {
+			item.Average_price = item.Price_sum / float64(item.Tick_count)
 			result[key] = item
 		}
 	}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"errors"
+	"marketflow/internal/adapters/memory"
+	"marketflow/internal/domain"
+	"testing"
+	"time"
+)
+
+func TestMergeAggregatedDataWeightsByTicks(t *testing.T) {
+	now := time.Now()
+	batch := func(ticks int64, sum float64) map[string]domain.ExchangeData {
+		return map[string]domain.ExchangeData{"Exchange1 BTCUSDT": {
+			Exchange:      "Exchange1",
+			Pair_name:     domain.BTCUSDT,
+			Timestamp:     now,
+			Average_price: sum / float64(ticks),
+			Tick_count:    ticks,
+			Price_sum:     sum,
+		}}
+	}
+
+	// One tick at 100 and three averaging 200
+	merged := MergeAggregatedData([]map[string]domain.ExchangeData{batch(1, 100), batch(3, 600)})
+
+	got := merged["Exchange1 BTCUSDT"]
+	if got.Average_price != 175 || got.Tick_count != 4 || got.Price_sum != 700 {
+		t.Errorf("merged = %+v, want an average of 175 over 4 ticks", got)
+	}
+}
+
+func TestSwitchModeStopsTheOldFetcher(t *testing.T) {
+	serv, _ := newTestService(t)
+	old := memory.NewFetcher(domain.ModeLive)
+	serv.Datafetcher = old
+	if err := serv.ListenAndSave(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The window timer of the old fetcher only returns once it is cancelled, the switch waits for it
+	switched := make(chan error, 1)
+	go func() {
+		_, err := serv.SwitchMode(domain.ModeTest, nil)
+		switched <- err
+	}()
+	select {
+	case err := <-switched:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("mode switch is still waiting for the goroutines of the old fetcher")
+	}
+	t.Cleanup(serv.StopListening)
+
+	if err := old.Push(domain.Data{ExchangeName: "Exchange1", Symbol: domain.BTCUSDT, Price: 1}); !errors.Is(err, memory.ErrFetcherClosed) {
+		t.Errorf("push to the old fetcher = %v, want %v", err, memory.ErrFetcherClosed)
+	}
+}
@@ -0,0 +1,275 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"marketflow/internal/domain"
+	"marketflow/pkg/logger"
+	"marketflow/pkg/metrics"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Merged aggregates of one window
+type window struct {
+	start time.Time
+	rows  map[string]domain.ExchangeData
+}
+
+// Groups the aggregates by the window their event time falls into and merges every group, oldest window first.
+// The rows are stamped with the start of their window.
+func mergeWindows(buffer []map[string]domain.ExchangeData) []window {
+	groups := make(map[time.Time][]map[string]domain.ExchangeData)
+	for _, dataMap := range buffer {
+		for key, data := range dataMap {
+			start := data.Timestamp.Truncate(domain.AggregationWindow)
+			groups[start] = append(groups[start], map[string]domain.ExchangeData{key: data})
+		}
+	}
+
+	windows := make([]window, 0, len(groups))
+	for start, group := range groups {
+		rows := MergeAggregatedData(group)
+		for key, data := range rows {
+			data.Timestamp = start
+			rows[key] = data
+		}
+		windows = append(windows, window{start: start, rows: rows})
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i].start.Before(windows[j].start) })
+
+	return windows
+}
+
+// Takes the aggregates of the windows ending before the watermark out of the buffer, must be called with mu held
+func (serv *DataModeServiceImp) takeClosedWindows(watermark time.Time) []window {
+	closedUntil := watermark.Truncate(domain.AggregationWindow)
+
+	closed := make([]map[string]domain.ExchangeData, 0)
+	open := make([]map[string]domain.ExchangeData, 0, len(serv.DataBuffer))
+	for _, dataMap := range serv.DataBuffer {
+		closedPart := make(map[string]domain.ExchangeData)
+		openPart := make(map[string]domain.ExchangeData)
+		for key, data := range dataMap {
+			if data.Timestamp.Before(closedUntil) {
+				closedPart[key] = data
+			} else {
+				openPart[key] = data
+			}
+		}
+
+		if len(closedPart) != 0 {
+			closed = append(closed, closedPart)
+		}
+		if len(openPart) != 0 {
+			open = append(open, openPart)
+		}
+	}
+
+	serv.DataBuffer = open
+	if closedUntil.After(serv.closedUntil) {
+		serv.closedUntil = closedUntil
+	}
+	return mergeWindows(closed)
+}
+
+// Flushes the windows the watermark passed into the stores and publishes them. The windows are taken
+// out under mu and saved without it, so a slow store does not hold up ingestion and the API.
+func (serv *DataModeServiceImp) flushClosedWindows(watermark time.Time) {
+	serv.mu.Lock()
+	windows := serv.takeClosedWindows(watermark)
+	serv.markSplit(windows)
+	serv.mu.Unlock()
+
+	serv.saveWindows(windows)
+
+	for _, w := range windows {
+		serv.Hub.PublishAggregates(w.rows)
+	}
+}
+
+// Flushes the whole buffer, bounded by domain.FlushTimeout. Windows that are not over yet are cut short
+// and their rows marked partial, as are the rows flushed later for the rest of such a window.
+// The buffer is taken out under mu and saved without it, so a hanging store does not block the service.
+// Windows not saved in time are appended to the spool after the one still saving, without a spool they are lost.
+func (serv *DataModeServiceImp) flushBuffer() {
+	serv.mu.Lock()
+	now := time.Now()
+	windows := mergeWindows(serv.DataBuffer)
+	serv.DataBuffer = nil
+	for _, w := range windows {
+		end := w.start.Add(domain.AggregationWindow)
+		if end.After(now) {
+			serv.splitWindow = w.start
+			continue
+		}
+		// Ticks of the windows that are over are late from now on
+		if end.After(serv.closedUntil) {
+			serv.closedUntil = end
+		}
+	}
+	serv.markSplit(windows)
+	serv.mu.Unlock()
+
+	// Windows are taken one by one, so those left after the timeout are neither saved nor spooled twice
+	var (
+		queueMu   sync.Mutex
+		next      int
+		abandoned bool
+	)
+	take := func() (window, bool) {
+		queueMu.Lock()
+		defer queueMu.Unlock()
+		if abandoned || next == len(windows) {
+			return window{}, false
+		}
+		next++
+		return windows[next-1], true
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		var dbErr, cacheErr error
+		for w, ok := take(); ok; w, ok = take() {
+			db, cache := serv.saveWindow(w)
+			dbErr, cacheErr = errors.Join(dbErr, db), errors.Join(cacheErr, cache)
+		}
+
+		serv.mu.Lock()
+		serv.recordFlush(dbErr, cacheErr)
+		serv.mu.Unlock()
+	}()
+
+	select {
+	case <-done:
+		logger.Info("Flushed aggregation buffer", "windows", len(windows))
+		return
+	case <-time.After(domain.FlushTimeout):
+	}
+
+	queueMu.Lock()
+	abandoned = true
+	left := windows[next:]
+	queueMu.Unlock()
+
+	if serv.Spool == nil {
+		logger.Error("Flushing the aggregation buffer did not finish in time, buffered data is lost", "timeout", domain.FlushTimeout.String(), "windows", len(left))
+		return
+	}
+
+	logger.Error("Flushing the aggregation buffer did not finish in time, spooling the rest", "timeout", domain.FlushTimeout.String(), "windows", len(left))
+	for _, w := range left {
+		if err := serv.Spool.Append(w.rows); err != nil {
+			logger.Error("Failed to spool aggregated data", "window", w.start, "error", err)
+		}
+	}
+}
+
+// Saves the windows into the database and the cache and records the outcome, must not be called with mu held
+func (serv *DataModeServiceImp) saveWindows(windows []window) {
+	var dbErr, cacheErr error
+	for _, w := range windows {
+		db, cache := serv.saveWindow(w)
+		dbErr, cacheErr = errors.Join(dbErr, db), errors.Join(cacheErr, cache)
+	}
+
+	serv.mu.Lock()
+	serv.recordFlush(dbErr, cacheErr)
+	serv.mu.Unlock()
+}
+
+// Marks the rows of the window cut short partial, must be called with mu held
+func (serv *DataModeServiceImp) markSplit(windows []window) {
+	for _, w := range windows {
+		if !w.start.Equal(serv.splitWindow) {
+			continue
+		}
+		for key, data := range w.rows {
+			data.Partial = true
+			w.rows[key] = data
+		}
+	}
+}
+
+// Saves the window into the database and the cache
+func (serv *DataModeServiceImp) saveWindow(w window) (dbErr, cacheErr error) {
+	if err := serv.saveAggregated(w.rows); err != nil {
+		logger.Error("Failed to save aggregated data to Db", "window", w.start, "error", err)
+		dbErr = err
+	}
+	if err := serv.Cache.SaveAggregatedData(w.rows); err != nil {
+		logger.Error("Failed to save aggregated data to cache", "window", w.start, "error", err)
+		cacheErr = err
+	}
+	return dbErr, cacheErr
+}
+
+// Must be called with mu held
+func (serv *DataModeServiceImp) recordFlush(dbErr, cacheErr error) {
+	now := time.Now()
+	serv.flushes.db, serv.flushes.dbErr = now, dbErr
+	serv.flushes.cache, serv.flushes.cacheErr = now, cacheErr
+}
+
+// Adds the aggregates to the buffer, those of windows already flushed are late and dropped or stored as corrections
+func (serv *DataModeServiceImp) bufferAggregates(data map[string]domain.ExchangeData) {
+	serv.mu.Lock()
+	late := make(map[string]domain.ExchangeData)
+	for key, agg := range data {
+		if agg.Timestamp.Before(serv.closedUntil) {
+			late[key] = agg
+			delete(data, key)
+		}
+	}
+	if len(data) != 0 {
+		serv.DataBuffer = append(serv.DataBuffer, data)
+	}
+	serv.mu.Unlock()
+
+	if len(late) != 0 {
+		serv.handleLate(late)
+	}
+}
+
+func (serv *DataModeServiceImp) handleLate(late map[string]domain.ExchangeData) {
+	action := domain.LateTicks
+	for key, agg := range late {
+		// "All" rows repeat the ticks of the exchanges
+		if strings.HasPrefix(key, "All ") {
+			continue
+		}
+		metrics.TicksLate.WithLabelValues(agg.Exchange, action).Add(float64(agg.Tick_count))
+		logger.Warn("Late ticks", "exchange", agg.Exchange, "symbol", agg.Pair_name, "ticks", agg.Tick_count, "event_time", agg.Timestamp, "action", action)
+	}
+
+	if action != domain.LateCorrect {
+		return
+	}
+
+	for _, w := range mergeWindows([]map[string]domain.ExchangeData{late}) {
+		for key, data := range w.rows {
+			data.Late = true
+			w.rows[key] = data
+		}
+		if err := serv.saveAggregated(w.rows); err != nil {
+			logger.Error("Failed to save late ticks correction to Db", "window", w.start, "error", err)
+		}
+	}
+}
+
+// Saves the aggregates into the database. With a spool they go into the spool instead while the database
+// fails or older aggregates wait in it, so they reach the database in order, the error is the spool's then.
+func (serv *DataModeServiceImp) saveAggregated(rows map[string]domain.ExchangeData) error {
+	if serv.Spool == nil {
+		return serv.DB.SaveAggregatedData(rows)
+	}
+
+	if err := serv.Spool.Write(rows); err != nil {
+		return fmt.Errorf("failed to spool aggregated data: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"marketflow/internal/adapters/memory"
+	"marketflow/internal/adapters/spool"
+	"marketflow/internal/domain"
+	"marketflow/pkg/logger"
+	"testing"
+	"time"
+)
+
+func newTestService(t *testing.T) (*DataModeServiceImp, *memory.Database) {
+	t.Helper()
+
+	log, window, late := logger.Log, domain.AggregationWindow, domain.LateTicks
+	t.Cleanup(func() {
+		logger.Log, domain.AggregationWindow, domain.LateTicks = log, window, late
+	})
+
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+	domain.AggregationWindow = time.Minute
+	domain.LateTicks = domain.LateDrop
+
+	db := memory.NewDatabase()
+	return NewDataFetcher(memory.NewFetcher(domain.ModeTest), db, memory.NewCache()), db
+}
+
+func aggregate(at time.Time, open, close float64) map[string]domain.ExchangeData {
+	return map[string]domain.ExchangeData{
+		"Exchange1 BTCUSDT": {
+			Exchange:      "Exchange1",
+			Pair_name:     domain.BTCUSDT,
+			Timestamp:     at,
+			Open_price:    open,
+			Close_price:   close,
+			Average_price: (open + close) / 2,
+			Min_price:     min(open, close),
+			Max_price:     max(open, close),
+			Tick_count:    2,
+		},
+	}
+}
+
+func TestFlushClosedWindows(t *testing.T) {
+	serv, db := newTestService(t)
+	window := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	// Arrives after the next window already started
+	serv.bufferAggregates(aggregate(window.Add(70*time.Second), 200, 201))
+	serv.bufferAggregates(aggregate(window.Add(50*time.Second), 102, 104))
+	serv.bufferAggregates(aggregate(window.Add(10*time.Second), 100, 101))
+
+	serv.flushClosedWindows(window.Add(time.Minute + time.Second))
+
+	rows := db.Aggregated()
+	if len(rows) != 1 {
+		t.Fatalf("stored %d rows, want the closed window only", len(rows))
+	}
+	if row := rows[0]; !row.Timestamp.Equal(window) || row.Open_price != 100 || row.Close_price != 104 || row.Tick_count != 4 {
+		t.Errorf("stored %+v, want the window at %v opened at 100 and closed at 104 with 4 ticks", row, window)
+	}
+
+	if len(serv.DataBuffer) != 1 || serv.DataBuffer[0]["Exchange1 BTCUSDT"].Open_price != 200 {
+		t.Errorf("buffer = %+v, want the open window only", serv.DataBuffer)
+	}
+}
+
+func TestLateTicks(t *testing.T) {
+	serv, db := newTestService(t)
+	window := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	serv.bufferAggregates(aggregate(window.Add(50*time.Second), 100, 104))
+	serv.flushClosedWindows(window.Add(time.Minute + time.Second))
+
+	serv.bufferAggregates(aggregate(window.Add(40*time.Second), 90, 110))
+	if len(db.Aggregated()) != 1 || len(serv.DataBuffer) != 0 {
+		t.Fatalf("late ticks were not dropped: %d rows stored, buffer = %+v", len(db.Aggregated()), serv.DataBuffer)
+	}
+
+	domain.LateTicks = domain.LateCorrect
+	serv.bufferAggregates(aggregate(window.Add(40*time.Second), 90, 110))
+
+	rows := db.Aggregated()
+	if len(rows) != 2 || !rows[1].Late || !rows[1].Timestamp.Equal(window) {
+		t.Fatalf("stored %+v, want a late correction row of the window at %v", rows, window)
+	}
+
+	candles, err := db.Candles("Exchange1", domain.BTCUSDT, time.Minute, window, window.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candles) != 1 || candles[0].Low != 90 || candles[0].High != 110 || candles[0].Close != 104 || candles[0].Ticks != 4 {
+		t.Errorf("candles = %+v, want low 90, high 110, the close of the window kept and 4 ticks", candles)
+	}
+}
+
+func TestFlushSpoolsWhileDatabaseFails(t *testing.T) {
+	serv, db := newTestService(t)
+	aggregates, err := spool.Open(t.TempDir(), 1<<20, db.SaveSpooledData, time.Millisecond, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(aggregates.Close)
+	serv.Spool = aggregates
+
+	window := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	db.Fail(errors.New("connection refused"))
+
+	serv.bufferAggregates(aggregate(window.Add(10*time.Second), 100, 101))
+	serv.flushClosedWindows(window.Add(time.Minute + time.Second))
+	serv.bufferAggregates(aggregate(window.Add(70*time.Second), 102, 103))
+	serv.flushClosedWindows(window.Add(2*time.Minute + time.Second))
+
+	report := serv.CheckHealth()
+	if report.Spool == nil || report.Spool.Records != 2 || report.Status == domain.HealthHealthy {
+		t.Fatalf("health = %+v, spool = %+v, want two spooled windows and not healthy", report, report.Spool)
+	}
+	if report.Database.LastFlushError != "" {
+		t.Errorf("last flush error = %q, want none as nothing was lost", report.Database.LastFlushError)
+	}
+
+	db.Fail(nil)
+	deadline := time.Now().Add(time.Second)
+	for aggregates.Health().Records != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("spool was not written into the database")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	rows := db.Aggregated()
+	if len(rows) != 2 || !rows[0].Timestamp.Equal(window) || !rows[1].Timestamp.Equal(window.Add(time.Minute)) {
+		t.Errorf("stored %+v, want both windows in order", rows)
+	}
+}
+
+func TestFlushBufferMarksWindowsCutShort(t *testing.T) {
+	serv, db := newTestService(t)
+	current := time.Now().Truncate(time.Minute)
+	previous := current.Add(-time.Minute)
+
+	serv.bufferAggregates(aggregate(previous.Add(50*time.Second), 100, 101))
+	serv.bufferAggregates(aggregate(current, 102, 103))
+	serv.flushBuffer()
+
+	rows := db.Aggregated()
+	if len(rows) != 2 || len(serv.DataBuffer) != 0 {
+		t.Fatalf("stored %+v with %d aggregates left in the buffer, want both windows stored", rows, len(serv.DataBuffer))
+	}
+	if rows[0].Partial || !rows[0].Timestamp.Equal(previous) {
+		t.Errorf("previous window = %+v, want it complete", rows[0])
+	}
+	if !rows[1].Partial || !rows[1].Timestamp.Equal(current) {
+		t.Errorf("current window = %+v, want it partial", rows[1])
+	}
+
+	// The rest of the window cut short is partial as well, the window before is over
+	serv.bufferAggregates(aggregate(previous.Add(55*time.Second), 90, 110))
+	serv.bufferAggregates(aggregate(current, 104, 105))
+	serv.flushClosedWindows(current.Add(time.Minute))
+
+	rows = db.Aggregated()
+	if len(rows) != 3 || !rows[2].Partial || !rows[2].Timestamp.Equal(current) {
+		t.Errorf("stored %+v, want a third partial row of the current window", rows)
+	}
+}
+
+// Database hanging on aggregate saves until released
+type hangingDatabase struct {
+	*memory.Database
+	release chan struct{}
+}
+
+func (d *hangingDatabase) SaveAggregatedData(aggregatedData map[string]domain.ExchangeData) error {
+	<-d.release
+	return d.Database.SaveAggregatedData(aggregatedData)
+}
+
+func (d *hangingDatabase) SaveSpooledData(batch string, aggregatedData map[string]domain.ExchangeData) error {
+	<-d.release
+	return d.Database.SaveSpooledData(batch, aggregatedData)
+}
+
+func TestFlushBufferSpoolsWhatIsNotSavedInTime(t *testing.T) {
+	serv, db := newTestService(t)
+	timeout := domain.FlushTimeout
+	t.Cleanup(func() { domain.FlushTimeout = timeout })
+	domain.FlushTimeout = 20 * time.Millisecond
+
+	hanging := &hangingDatabase{Database: db, release: make(chan struct{})}
+	serv.DB = hanging
+	aggregates, err := spool.Open(t.TempDir(), 1<<20, hanging.SaveSpooledData, time.Millisecond, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(aggregates.Close)
+	serv.Spool = aggregates
+
+	first := time.Now().Truncate(time.Minute).Add(-2 * time.Minute)
+	serv.bufferAggregates(aggregate(first, 100, 101))
+	serv.bufferAggregates(aggregate(first.Add(time.Minute), 102, 103))
+	serv.flushBuffer()
+
+	// The lock is not held by the save still hanging
+	if !serv.mu.TryLock() {
+		t.Fatal("flush returned with the service lock held")
+	}
+	serv.mu.Unlock()
+	// The hanging window goes first, its save is not repeated if it succeeds after all
+	if health := aggregates.Health(); health.Records != 2 {
+		t.Errorf("spool = %+v, want both windows spooled", health)
+	}
+
+	close(hanging.release)
+	deadline := time.Now().Add(time.Second)
+	for len(db.Aggregated()) != 2 || aggregates.Health().Records != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("stored %+v, want the hanging window saved and the other one spooled", db.Aggregated())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFlushClosedWindowsSavesWithoutTheLock(t *testing.T) {
+	serv, db := newTestService(t)
+	hanging := &hangingDatabase{Database: db, release: make(chan struct{})}
+	serv.DB = hanging
+
+	window := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	serv.bufferAggregates(aggregate(window.Add(10*time.Second), 100, 101))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		serv.flushClosedWindows(window.Add(time.Minute + time.Second))
+	}()
+
+	// Ticks keep being buffered while the save hangs
+	deadline := time.Now().Add(time.Second)
+	for {
+		serv.mu.Lock()
+		taken := len(serv.DataBuffer) == 0
+		serv.mu.Unlock()
+		if taken {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("closed window was not taken out of the buffer")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	serv.bufferAggregates(aggregate(window.Add(70*time.Second), 102, 103))
+
+	close(hanging.release)
+	<-done
+	if rows := db.Aggregated(); len(rows) != 1 || len(serv.DataBuffer) != 1 {
+		t.Errorf("stored %+v with %d aggregates buffered, want the closed window stored and the next one buffered", rows, len(serv.DataBuffer))
+	}
+}
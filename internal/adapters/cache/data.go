@@ -3,13 +3,18 @@ package cache
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"marketflow/internal/domain"
+	"marketflow/pkg/metrics"
 	"time"
+
+	"github.com/redis/go-redis/v9"
 )
 
 // SaveLatestData saves the most recent data points to the cache with a 5-minute expiration.
-func (c *RedisCache) SaveLatestData(latestData map[string]domain.Data) error {
+func (c *RedisCache) SaveLatestData(latestData map[string]domain.Data) (err error) {
+	defer func(start time.Time) { metrics.ObserveStore(metrics.Redis, "save_latest", start, err) }(time.Now())
+
 	expiration := 5 * time.Minute
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
@@ -31,7 +36,9 @@ func (c *RedisCache) SaveLatestData(latestData map[string]domain.Data) error {
 }
 
 // SaveAggregatedData saves aggregated data to the cache with a 5-minute expiration.
-func (c *RedisCache) SaveAggregatedData(aggregatedData map[string]domain.ExchangeData) error {
+func (c *RedisCache) SaveAggregatedData(aggregatedData map[string]domain.ExchangeData) (err error) {
+	defer func(start time.Time) { metrics.ObserveStore(metrics.Redis, "save_aggregated", start, err) }(time.Now())
+
 	expiration := 5 * time.Minute
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
@@ -56,9 +63,9 @@ func (c *RedisCache) LatestData(exchange, symbol string) (domain.Data, error) {
 	defer cancel()
 	key := "latest " + exchange + " " + symbol
 	res, err := c.client.Get(ctx, key).Result()
-
-	fmt.Println("DEBUG: ", res)
-
+	if errors.Is(err, redis.Nil) {
+		return domain.Data{}, domain.ErrCacheMiss
+	}
 	if err != nil {
 		return domain.Data{}, err
 	}
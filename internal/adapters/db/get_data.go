@@ -1,8 +1,9 @@
 package db
 
 import (
+	"database/sql"
+	"fmt"
 	"marketflow/internal/domain"
-	"marketflow/pkg/logger"
 	"time"
 )
 
@@ -65,373 +66,270 @@ func (repo *PostgresRepository) LatestDataByAllExchanges(symbol string) (domain.
 }
 
 // Gets the average price data by exchange over all period
-func (repo *PostgresRepository) AveragePriceByExchange(exchange, symbol string) (domain.Data, error) {
+func (repo *PostgresRepository) AveragePriceByExchange(exchange, symbol string) (domain.Data, int64, error) {
 	data := domain.Data{
 		ExchangeName: exchange,
 		Symbol:       symbol,
 	}
 
-	rows, err := repo.db.Query(`
-	SELECT COALESCE(AVG(Average_price), 0) FROM AggregatedData
+	source := repo.aggregatesSince(time.Time{})
+	rows, err := repo.db.Query(fmt.Sprintf(`
+	SELECT COALESCE(SUM(Price_sum) / NULLIF(SUM(Tick_count), 0), 0), COALESCE(SUM(Tick_count), 0) FROM %s
 	WHERE Exchange = $1 AND Pair_name = $2
-	`, exchange, symbol)
+	`, source), exchange, symbol)
 	if err != nil {
-		return domain.Data{}, err
+		return domain.Data{}, 0, err
 	}
 	defer rows.Close()
 
+	var ticks int64
 	for rows.Next() {
-		if err := rows.Scan(&data.Price); err != nil {
-			return domain.Data{}, err
+		if err := rows.Scan(&data.Price, &ticks); err != nil {
+			return domain.Data{}, 0, err
 		}
 	}
 
-	return data, nil
+	return data, ticks, nil
 }
 
 // Gets the average price by exchange over all period
-func (repo *PostgresRepository) AveragePriceByAllExchanges(symbol string) (domain.Data, error) {
+func (repo *PostgresRepository) AveragePriceByAllExchanges(symbol string) (domain.Data, int64, error) {
 	data := domain.Data{
 		ExchangeName: "All",
 		Symbol:       symbol,
 	}
 
-	rows, err := repo.db.Query(`
-	SELECT COALESCE(AVG(Average_price), 0) from AggregatedData
+	source := repo.aggregatesSince(time.Time{})
+	rows, err := repo.db.Query(fmt.Sprintf(`
+	SELECT COALESCE(SUM(Price_sum) / NULLIF(SUM(Tick_count), 0), 0), COALESCE(SUM(Tick_count), 0) FROM %s
 	WHERE Pair_name = $1 AND Exchange = 'All'
-	`, symbol)
+	`, source), symbol)
 	if err != nil {
-		return domain.Data{}, err
+		return domain.Data{}, 0, err
 	}
 	defer rows.Close()
 
+	var ticks int64
 	for rows.Next() {
-		if err := rows.Scan(&data.Price); err != nil {
-			return domain.Data{}, err
+		if err := rows.Scan(&data.Price, &ticks); err != nil {
+			return domain.Data{}, 0, err
 		}
 	}
-	logger.Debug("Debuger: ", data)
-	return data, nil
+	return data, ticks, nil
 }
 
 // Gets the average price within the last {duration}
-func (repo *PostgresRepository) AveragePriceWithDuration(exchange, symbol string, startTime time.Time, duration time.Duration) (domain.Data, error) {
+func (repo *PostgresRepository) AveragePriceWithDuration(exchange, symbol string, startTime time.Time, duration time.Duration) (domain.Data, int64, error) {
 	data := domain.Data{
 		ExchangeName: exchange,
 		Symbol:       symbol,
 	}
 
-	rows, err := repo.db.Query(`
-	SELECT COALESCE(AVG(Average_price), 0) FROM AggregatedData
+	source := repo.aggregatesSince(startTime.Add(-duration))
+	rows, err := repo.db.Query(fmt.Sprintf(`
+	SELECT COALESCE(SUM(Price_sum) / NULLIF(SUM(Tick_count), 0), 0), COALESCE(SUM(Tick_count), 0) FROM %s
 	WHERE Exchange = $1 AND Pair_name = $2 AND StoredTime BETWEEN $3 and $4
-	`, exchange, symbol, startTime.Add(-duration), startTime)
+	`, source), exchange, symbol, startTime.Add(-duration), startTime)
 	if err != nil {
-		return domain.Data{}, err
+		return domain.Data{}, 0, err
 	}
 	defer rows.Close()
 
+	var ticks int64
 	for rows.Next() {
-		if err := rows.Scan(&data.Price); err != nil {
-			return domain.Data{}, err
+		if err := rows.Scan(&data.Price, &ticks); err != nil {
+			return domain.Data{}, 0, err
 		}
 	}
 
-	return data, nil
+	return data, ticks, nil
 }
 
 // Min by all exchange and all time
 func (repo *PostgresRepository) MinPriceByAllExchanges(symbol string) (domain.Data, error) {
-	data := domain.Data{
-		ExchangeName: "All",
-		Symbol:       symbol,
-	}
-
-	rows, err := repo.db.Query(`
-SELECT Pair_name, exchange, StoredTime, Min_price
-FROM AggregatedData
-WHERE 
-    Pair_name = $1  AND exchange = 'All'
-    AND Min_price = (
-        SELECT MIN(Min_price)
-        FROM AggregatedData
-        WHERE 
-            Pair_name = $1
-            AND exchange = 'All'
-    );
-	`, symbol)
-	if err != nil {
-		return domain.Data{}, err
-	}
-	defer rows.Close()
-
-	var t time.Time
-	for rows.Next() {
-		if err := rows.Scan(&data.Symbol, &data.ExchangeName, &t, &data.Price); err != nil {
-			return domain.Data{}, err
-		}
-	}
-	data.Timestamp = t.UnixMilli()
-
-	return data, nil
+	return repo.extremePrice("All", symbol, "Min_price", "ASC", time.Time{}, time.Time{})
 }
 
 // Min by one exchange and all time
 func (repo *PostgresRepository) MinPriceByExchange(exchange, symbol string) (domain.Data, error) {
-	data := domain.Data{
-		ExchangeName: exchange,
-		Symbol:       symbol,
-	}
-
-	rows, err := repo.db.Query(`
-SELECT Pair_name, exchange, StoredTime, Min_price
-FROM AggregatedData
-WHERE 
-    Pair_name = $1  AND exchange = $2
-    AND Min_price = (
-        SELECT MIN(Min_price)
-        FROM AggregatedData
-        WHERE 
-            Pair_name = $1
-            AND exchange = $2
-    );
-	`, exchange, symbol)
-	if err != nil {
-		return domain.Data{}, err
-	}
-	defer rows.Close()
-
-	var t time.Time
-	for rows.Next() {
-		if err := rows.Scan(&data.Symbol, &data.ExchangeName, &t, &data.Price); err != nil {
-			return domain.Data{}, err
-		}
-	}
-	data.Timestamp = t.UnixMilli()
-
-	return data, nil
+	return repo.extremePrice(exchange, symbol, "Min_price", "ASC", time.Time{}, time.Time{})
 }
 
 // Min by one exchange on period
 func (repo *PostgresRepository) MinPriceByExchangeWithDuration(exchange, symbol string, startTime time.Time, duration time.Duration) (domain.Data, error) {
-	data := domain.Data{
-		ExchangeName: exchange,
-		Symbol:       symbol,
-	}
+	return repo.extremePrice(exchange, symbol, "Min_price", "ASC", startTime.Add(-duration), startTime)
+}
 
-	rows, err := repo.db.Query(`
-SELECT Pair_name, exchange, StoredTime, Min_price
-FROM AggregatedData
-WHERE 
-    Pair_name = $1  AND exchange =  $2 AND StoredTime BETWEEN $3 AND $4
-    AND Min_price = (
-        SELECT MIN(Min_price)
-        FROM AggregatedData
-        WHERE 
-            Pair_name = $1
-            AND exchange = $2
-            AND StoredTime BETWEEN $3 AND $4
-    );
-	`, symbol, exchange, startTime.Add(-duration), startTime)
-	if err != nil {
-		return domain.Data{}, err
-	}
-	defer rows.Close()
+// Min by all exchange on period
+func (repo *PostgresRepository) MinPriceByAllExchangesWithDuration(symbol string, startTime time.Time, duration time.Duration) (domain.Data, error) {
+	return repo.extremePrice("All", symbol, "Min_price", "ASC", startTime.Add(-duration), startTime)
+}
 
-	var t time.Time
-	for rows.Next() {
-		if err := rows.Scan(&data.Symbol, &data.ExchangeName, &t, &data.Price); err != nil {
-			return domain.Data{}, err
-		}
-	}
+// Max by all exchange all time
+func (repo *PostgresRepository) MaxPriceByAllExchanges(symbol string) (domain.Data, error) {
+	return repo.extremePrice("All", symbol, "Max_price", "DESC", time.Time{}, time.Time{})
+}
 
-	data.Timestamp = t.UnixMilli()
+// Max by one exchange on all time
+func (repo *PostgresRepository) MaxPriceByExchange(exchange, symbol string) (domain.Data, error) {
+	return repo.extremePrice(exchange, symbol, "Max_price", "DESC", time.Time{}, time.Time{})
+}
 
-	return data, nil
+// Max by one exchange on period
+func (repo *PostgresRepository) MaxPriceByExchangeWithDuration(exchange, symbol string, startTime time.Time, duration time.Duration) (domain.Data, error) {
+	return repo.extremePrice(exchange, symbol, "Max_price", "DESC", startTime.Add(-duration), startTime)
 }
 
-// Min by one exchange on period
-func (repo *PostgresRepository) MinPriceByAllExchangesWithDuration(symbol string, startTime time.Time, duration time.Duration) (domain.Data, error) {
+// Max by all exchange on period
+func (repo *PostgresRepository) MaxPriceByAllExchangesWithDuration(symbol string, startTime time.Time, duration time.Duration) (domain.Data, error) {
+	return repo.extremePrice("All", symbol, "Max_price", "DESC", startTime.Add(-duration), startTime)
+}
+
+// Row with the lowest (ASC) or highest (DESC) value of the price column, over all time for a zero from,
+// otherwise within [from, to]. The index on the exchange, pair and price column finds it without a scan.
+func (repo *PostgresRepository) extremePrice(exchange, symbol, column, order string, from, to time.Time) (domain.Data, error) {
 	data := domain.Data{
-		ExchangeName: "All",
+		ExchangeName: exchange,
 		Symbol:       symbol,
 	}
 
-	rows, err := repo.db.Query(`
-SELECT Pair_name, exchange, StoredTime, Min_price
-FROM AggregatedData
-WHERE 
-    Pair_name = $1  AND exchange = 'All' AND StoredTime BETWEEN $2 AND $3
-    AND Min_price = (
-        SELECT MIN(Min_price)
-        FROM AggregatedData
-        WHERE 
-            Pair_name = $1
-            AND exchange = 'All'
-            AND StoredTime BETWEEN $2 AND $3
-    );
-	`, symbol, startTime.Add(-duration), startTime)
-	if err != nil {
-		return domain.Data{}, err
+	query := `
+SELECT StoredTime, %[2]s
+FROM %[1]s
+WHERE Exchange = $1 AND Pair_name = $2`
+	args := []any{exchange, symbol}
+	if !from.IsZero() {
+		query += ` AND StoredTime BETWEEN $3 AND $4`
+		args = append(args, from, to)
 	}
-	defer rows.Close()
+	query += `
+ORDER BY %[2]s %[3]s
+LIMIT 1;`
 
 	var t time.Time
-	for rows.Next() {
-		if err := rows.Scan(&data.Symbol, &data.ExchangeName, &t, &data.Price); err != nil {
-			return domain.Data{}, err
-		}
-	}
-	data.Timestamp = t.UnixMilli()
-
-	return data, nil
-}
-
-// Max by all exchange all time
-func (repo *PostgresRepository) MaxPriceByAllExchanges(symbol string) (domain.Data, error) {
-	data := domain.Data{
-		ExchangeName: "All",
-		Symbol:       symbol,
+	err := repo.db.QueryRow(fmt.Sprintf(query, repo.aggregatesSince(from), column, order), args...).Scan(&t, &data.Price)
+	if err == sql.ErrNoRows {
+		return data, nil
 	}
-
-	rows, err := repo.db.Query(`
-SELECT Pair_name, exchange, StoredTime, Max_price
-FROM AggregatedData
-WHERE 
-    Pair_name = $1  AND exchange = 'All'
-    AND Max_price = (
-        SELECT MAX(Max_price)
-        FROM AggregatedData
-        WHERE 
-            Pair_name = $1
-            AND exchange = 'All'
-    );
-
-	`, symbol)
 	if err != nil {
 		return domain.Data{}, err
 	}
-	defer rows.Close()
-
-	var t time.Time
-	for rows.Next() {
-		if err := rows.Scan(&data.Symbol, &data.ExchangeName, &t, &data.Price); err != nil {
-			return domain.Data{}, err
-		}
-	}
 	data.Timestamp = t.UnixMilli()
 
 	return data, nil
 }
 
-// Max by one exchange on all time
-func (repo *PostgresRepository) MaxPriceByExchange(exchange, symbol string) (domain.Data, error) {
-	data := domain.Data{
-		ExchangeName: exchange,
-		Symbol:       symbol,
-	}
-
+// Candles of the given interval in [from, to), rolled up from the base window candles
+func (repo *PostgresRepository) Candles(exchange, symbol string, interval time.Duration, from, to time.Time) ([]domain.Candle, error) {
 	rows, err := repo.db.Query(`
-SELECT Pair_name, exchange, StoredTime, Max_price
-FROM AggregatedData
-WHERE 
-    Pair_name = $1  AND exchange = $2
-    AND Max_price = (
-        SELECT MAX(Max_price)
-        FROM AggregatedData
-        WHERE 
-            Pair_name = $1
-            AND exchange = $2
-    );
-	`, symbol, exchange)
+SELECT
+    date_bin($3::interval, OpenTime, TIMESTAMPTZ '2000-01-01 00:00:00+00') AS Bucket,
+    (array_agg(Open_price ORDER BY OpenTime ASC))[1],
+    MAX(High_price),
+    MIN(Low_price),
+    (array_agg(Close_price ORDER BY OpenTime DESC))[1],
+    SUM(Tick_count)
+FROM Candles
+WHERE
+    Exchange = $1 AND Pair_name = $2
+    AND OpenTime >= $4 AND OpenTime < $5
+GROUP BY Bucket
+ORDER BY Bucket;
+	`, exchange, symbol, fmt.Sprintf("%d seconds", int64(interval/time.Second)), from, to)
 	if err != nil {
-		return domain.Data{}, err
+		return nil, err
 	}
 	defer rows.Close()
 
-	var t time.Time
+	candles := make([]domain.Candle, 0)
 	for rows.Next() {
-		if err := rows.Scan(&data.Symbol, &data.ExchangeName, &t, &data.Price); err != nil {
-			return domain.Data{}, err
+		candle := domain.Candle{
+			Exchange: exchange,
+			Symbol:   symbol,
+		}
+		if err := rows.Scan(&candle.OpenTime, &candle.Open, &candle.High, &candle.Low, &candle.Close, &candle.Ticks); err != nil {
+			return nil, err
 		}
+		candles = append(candles, candle)
 	}
-	data.Timestamp = t.UnixMilli()
 
-	return data, nil
+	return candles, rows.Err()
 }
 
-// Max by one exchange on period
-func (repo *PostgresRepository) MaxPriceByExchangeWithDuration(exchange, symbol string, startTime time.Time, duration time.Duration) (domain.Data, error) {
-	data := domain.Data{
-		ExchangeName: exchange,
-		Symbol:       symbol,
+// Stored aggregates in [from, to), ordered by time. With a non-zero step rows are
+// grouped into step long buckets, otherwise every stored window is returned.
+func (repo *PostgresRepository) PriceHistory(exchange, symbol string, from, to time.Time, step time.Duration, limit, offset int) ([]domain.PricePoint, error) {
+	var (
+		rows *sql.Rows
+		err  error
+	)
+
+	source := repo.aggregatesSince(from)
+	if step == 0 {
+		rows, err = repo.db.Query(fmt.Sprintf(`
+SELECT StoredTime, Average_price, Min_price, Max_price, Partial
+FROM %s
+WHERE
+    Exchange = $1 AND Pair_name = $2
+    AND StoredTime >= $3 AND StoredTime < $4
+ORDER BY StoredTime
+LIMIT $5 OFFSET $6;
+		`, source), exchange, symbol, from, to, limit, offset)
+	} else {
+		rows, err = repo.db.Query(fmt.Sprintf(`
+SELECT
+    date_bin($7::interval, StoredTime, TIMESTAMPTZ '2000-01-01 00:00:00+00') AS Bucket,
+    SUM(Price_sum) / NULLIF(SUM(Tick_count), 0),
+    MIN(Min_price),
+    MAX(Max_price),
+    BOOL_OR(Partial)
+FROM %s
+WHERE
+    Exchange = $1 AND Pair_name = $2
+    AND StoredTime >= $3 AND StoredTime < $4
+GROUP BY Bucket
+ORDER BY Bucket
+LIMIT $5 OFFSET $6;
+		`, source), exchange, symbol, from, to, limit, offset, fmt.Sprintf("%d seconds", int64(step/time.Second)))
 	}
-
-	rows, err := repo.db.Query(`
-SELECT Pair_name, exchange, StoredTime, Max_price
-FROM AggregatedData
-WHERE 
-    Pair_name = $1  AND exchange = $2 AND StoredTime BETWEEN $3 AND $4
-    AND Max_price = (
-        SELECT MAX(Max_price)
-        FROM AggregatedData
-        WHERE 
-            Pair_name = $1
-            AND exchange = $2
-            AND StoredTime BETWEEN $3 AND $4
-    );
-	`, symbol, exchange, startTime.Add(-duration), startTime)
 	if err != nil {
-		return domain.Data{}, err
+		return nil, err
 	}
 	defer rows.Close()
 
-	var t time.Time
+	points := make([]domain.PricePoint, 0)
 	for rows.Next() {
-		if err := rows.Scan(&data.Symbol, &data.ExchangeName, &t, &data.Price); err != nil {
-			return domain.Data{}, err
+		var point domain.PricePoint
+		if err := rows.Scan(&point.Timestamp, &point.Average_price, &point.Min_price, &point.Max_price, &point.Partial); err != nil {
+			return nil, err
 		}
+		points = append(points, point)
 	}
 
-	data.Timestamp = t.UnixMilli()
-
-	return data, nil
+	return points, rows.Err()
 }
 
-// Max by all exchange on period
-func (repo *PostgresRepository) MaxPriceByAllExchangesWithDuration(symbol string, startTime time.Time, duration time.Duration) (domain.Data, error) {
-	data := domain.Data{
-		ExchangeName: "All",
-		Symbol:       symbol,
-	}
-
+// Raw ticks received in [from, to), in the order they were received
+func (repo *PostgresRepository) RawTicks(from, to time.Time) ([]domain.Data, error) {
 	rows, err := repo.db.Query(`
-SELECT Pair_name, exchange, StoredTime, Max_price
-FROM AggregatedData
-WHERE 
-    Pair_name = $1  AND exchange = 'All' AND StoredTime BETWEEN $2 AND $3
-    AND Max_price = (
-        SELECT MAX(Max_price)
-        FROM AggregatedData
-        WHERE 
-            Pair_name = $1
-            AND exchange = 'All'
-            AND StoredTime BETWEEN $2 AND $3
-    );
-
-	`, symbol, startTime.Add(-duration), startTime)
+SELECT Exchange, Pair_name, Price, ExchangeTime
+FROM RawTicks
+WHERE ReceivedTime >= $1 AND ReceivedTime < $2
+ORDER BY ReceivedTime, ExchangeTime;
+	`, from, to)
 	if err != nil {
-		return domain.Data{}, err
+		return nil, err
 	}
 	defer rows.Close()
 
-	var t time.Time
+	ticks := make([]domain.Data, 0)
 	for rows.Next() {
-		if err := rows.Scan(&data.Symbol, &data.ExchangeName, &t, &data.Price); err != nil {
-			return domain.Data{}, err
+		var data domain.Data
+		if err := rows.Scan(&data.ExchangeName, &data.Symbol, &data.Price, &data.Timestamp); err != nil {
+			return nil, err
 		}
+		ticks = append(ticks, data)
 	}
 
-	data.Timestamp = t.UnixMilli()
-
-	return data, nil
+	return ticks, rows.Err()
 }
@@ -0,0 +1,248 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"marketflow/pkg/logger"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Migration is a numbered schema change with the statements applying and reverting it
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus tells if and when a migration was applied. Applied versions missing
+// from the migrations of the binary are reported with an empty name.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time // nil while pending
+}
+
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// LoadMigrations reads the NNN_name.up.sql and NNN_name.down.sql pairs of the directory, ordered by version
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, file := range files {
+		match := migrationFile.FindStringSubmatch(file)
+		if match == nil {
+			return nil, fmt.Errorf("migration file %s must be named NNN_name.up.sql or NNN_name.down.sql", file)
+		}
+
+		version, err := strconv.Atoi(match[1])
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("migration file %s has an invalid version", file)
+		}
+
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %03d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// MigrateUp applies the pending migrations in order, each in its own transaction, and returns how many were applied.
+// Instances migrating at the same time wait for each other on the lock of the schema_migrations table.
+func (repo *PostgresRepository) MigrateUp(migrations []Migration) (int, error) {
+	if err := repo.createMigrationTable(); err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	for _, m := range migrations {
+		done, err := repo.inMigration(func(tx *sql.Tx) (bool, error) {
+			var exists bool
+			if err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM schema_migrations WHERE Version = $1);`, m.Version).Scan(&exists); err != nil {
+				return false, err
+			}
+			if exists {
+				return false, nil
+			}
+
+			if _, err := tx.Exec(m.Up); err != nil {
+				return false, err
+			}
+			_, err := tx.Exec(`INSERT INTO schema_migrations (Version, Name) VALUES ($1, $2);`, m.Version, m.Name)
+			return err == nil, err
+		})
+		if err != nil {
+			return applied, fmt.Errorf("failed to apply migration %03d_%s: %w", m.Version, m.Name, err)
+		}
+
+		if done {
+			logger.Info("Applied migration", "version", m.Version, "name", m.Name)
+			applied++
+		}
+	}
+
+	return applied, nil
+}
+
+// MigrateDown reverts the last applied migrations, at most steps of them, and returns how many were reverted
+func (repo *PostgresRepository) MigrateDown(migrations []Migration, steps int) (int, error) {
+	if err := repo.createMigrationTable(); err != nil {
+		return 0, err
+	}
+
+	known := make(map[int]Migration, len(migrations))
+	for _, m := range migrations {
+		known[m.Version] = m
+	}
+
+	reverted := 0
+	for reverted < steps {
+		var m Migration
+		done, err := repo.inMigration(func(tx *sql.Tx) (bool, error) {
+			var version int
+			err := tx.QueryRow(`SELECT Version FROM schema_migrations ORDER BY Version DESC LIMIT 1;`).Scan(&version)
+			if err == sql.ErrNoRows {
+				return false, nil
+			}
+			if err != nil {
+				return false, err
+			}
+
+			var ok bool
+			if m, ok = known[version]; !ok {
+				return false, fmt.Errorf("applied migration %d is unknown to this binary", version)
+			}
+
+			if _, err := tx.Exec(m.Down); err != nil {
+				return false, err
+			}
+			_, err = tx.Exec(`DELETE FROM schema_migrations WHERE Version = $1;`, version)
+			return err == nil, err
+		})
+		if err != nil {
+			return reverted, fmt.Errorf("failed to revert migration: %w", err)
+		}
+		if !done {
+			break
+		}
+
+		logger.Info("Reverted migration", "version", m.Version, "name", m.Name)
+		reverted++
+	}
+
+	return reverted, nil
+}
+
+// MigrationStatus lists the migrations with the time they were applied, followed by applied versions the binary does not know
+func (repo *PostgresRepository) MigrationStatus(migrations []Migration) ([]MigrationStatus, error) {
+	if err := repo.createMigrationTable(); err != nil {
+		return nil, err
+	}
+
+	rows, err := repo.db.Query(`SELECT Version, AppliedAt FROM schema_migrations ORDER BY Version;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	versions := make([]int, 0)
+	for rows.Next() {
+		var (
+			version int
+			at      time.Time
+		)
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+		versions = append(versions, version)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name}
+		if at, ok := applied[m.Version]; ok {
+			status.AppliedAt = &at
+			delete(applied, m.Version)
+		}
+		statuses = append(statuses, status)
+	}
+
+	for _, version := range versions {
+		if at, ok := applied[version]; ok {
+			statuses = append(statuses, MigrationStatus{Version: version, AppliedAt: &at})
+		}
+	}
+
+	return statuses, nil
+}
+
+func (repo *PostgresRepository) createMigrationTable() error {
+	_, err := repo.db.Exec(`
+CREATE TABLE IF NOT EXISTS schema_migrations(
+    Version INTEGER PRIMARY KEY,
+    Name VARCHAR NOT NULL,
+    AppliedAt TimestampTZ NOT NULL DEFAULT NOW()
+);
+	`)
+	return err
+}
+
+// Runs fn in a transaction holding the lock of schema_migrations, committing if it reports a change
+func (repo *PostgresRepository) inMigration(fn func(tx *sql.Tx) (bool, error)) (bool, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := tx.Exec(`LOCK TABLE schema_migrations IN EXCLUSIVE MODE;`); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	changed, err := fn(tx)
+	if err != nil || !changed {
+		tx.Rollback()
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
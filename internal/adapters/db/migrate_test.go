@@ -0,0 +1,69 @@
+package db
+
+import (
+	"marketflow/migrations"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"010_later.up.sql":   {Data: []byte("CREATE TABLE Later();")},
+		"010_later.down.sql": {Data: []byte("DROP TABLE Later;")},
+		"002_first.up.sql":   {Data: []byte("CREATE TABLE First();")},
+		"002_first.down.sql": {Data: []byte("DROP TABLE First;")},
+		"migrations.go":      {Data: []byte("package migrations")},
+	}
+
+	got, err := LoadMigrations(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Migration{
+		{Version: 2, Name: "first", Up: "CREATE TABLE First();", Down: "DROP TABLE First;"},
+		{Version: 10, Name: "later", Up: "CREATE TABLE Later();", Down: "DROP TABLE Later;"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d migrations, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("migration %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestLoadMigrationsErrors(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"missing down": {
+			"001_init.up.sql": {Data: []byte("SELECT 1;")},
+		},
+		"names differ": {
+			"001_init.up.sql":    {Data: []byte("SELECT 1;")},
+			"001_other.down.sql": {Data: []byte("SELECT 1;")},
+		},
+		"bad name": {
+			"init.sql": {Data: []byte("SELECT 1;")},
+		},
+	}
+	for name, fsys := range tests {
+		if _, err := LoadMigrations(fsys); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	all, err := LoadMigrations(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Versions are numbered without gaps
+	for i, m := range all {
+		if m.Version != i+1 {
+			t.Errorf("migration %d has version %d, want %d", i, m.Version, i+1)
+		}
+	}
+}
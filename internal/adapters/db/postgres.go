@@ -6,13 +6,17 @@ import (
 	"log"
 	"marketflow/pkg/config"
 	"marketflow/pkg/logger"
+	"sync"
 	"time"
 
 	_ "github.com/lib/pq"
 )
 
 type PostgresRepository struct {
-	db *sql.DB
+	db         *sql.DB
+	retention  *retention // set by the compactor, nil reads the window rows only
+	mu         sync.Mutex
+	partitions map[string]bool // partitions known to exist, guarded by mu
 }
 
 func NewPostgres() *PostgresRepository {
@@ -56,10 +60,30 @@ func NewPostgres() *PostgresRepository {
 	}
 
 	logger.Info("postgres connection established")
-	return &PostgresRepository{db: db}
+	return &PostgresRepository{db: db, partitions: make(map[string]bool)}
 }
 
 func (r *PostgresRepository) Close() error {
 	logger.Info("closing postgres connection")
 	return r.db.Close()
 }
+
+// Creates the partition [from, to) of the parent table, once per process
+func (r *PostgresRepository) ensurePartition(parent, name string, from, to time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.partitions[name] {
+		return nil
+	}
+
+	_, err := r.db.Exec(fmt.Sprintf(
+		`CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s');`,
+		name, parent, from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339),
+	))
+	if err != nil {
+		return fmt.Errorf("failed to create partition %s: %w", name, err)
+	}
+
+	r.partitions[name] = true
+	return nil
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"marketflow/internal/domain"
+	"marketflow/pkg/logger"
+	"math"
+	"sync"
+)
+
+// Number of batches queued for writing before new rejected ticks are dropped
+const quarantineQueue = 256
+
+// QuarantineWriter stores ticks rejected by validation into the QuarantinedTicks table.
+// Writes happen in the background, so a burst of bad ticks never blocks ingestion.
+type QuarantineWriter struct {
+	repo      *PostgresRepository
+	queue     chan []domain.RejectedTick
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// Static check to ensure that QuarantineWriter implements TickQuarantine interface
+var _ domain.TickQuarantine = (*QuarantineWriter)(nil)
+
+func (repo *PostgresRepository) NewQuarantineWriter() *QuarantineWriter {
+	w := &QuarantineWriter{
+		repo:  repo,
+		queue: make(chan []domain.RejectedTick, quarantineQueue),
+		done:  make(chan struct{}),
+	}
+
+	go w.run()
+	return w
+}
+
+// Quarantine queues the ticks for writing, they are dropped if the queue is full
+func (w *QuarantineWriter) Quarantine(ticks []domain.RejectedTick) {
+	select {
+	case w.queue <- ticks:
+	default:
+		logger.Warn("Quarantine queue is full, dropping rejected ticks", "count", len(ticks))
+	}
+}
+
+// Close writes the queued ticks and stops the writer
+func (w *QuarantineWriter) Close() {
+	w.closeOnce.Do(func() {
+		close(w.queue)
+		<-w.done
+	})
+}
+
+func (w *QuarantineWriter) run() {
+	defer close(w.done)
+
+	for ticks := range w.queue {
+		if err := w.insert(ticks); err != nil {
+			logger.Error("Failed to write quarantined ticks", "count", len(ticks), "error", err.Error())
+		}
+	}
+}
+
+func (w *QuarantineWriter) insert(ticks []domain.RejectedTick) error {
+	tx, err := w.repo.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO QuarantinedTicks (Exchange, Pair_name, Price, ExchangeTime, ReceivedTime, Reason, Median)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, tick := range ticks {
+		var median any
+		if tick.Median != 0 {
+			median = tick.Median
+		}
+
+		if _, err := stmt.Exec(tick.ExchangeName, tick.Symbol, floatParam(tick.Price), tick.Timestamp, tick.Received, tick.Reason, median); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// The driver formats infinities as Go does, PostgreSQL only reads its own spelling
+func floatParam(v float64) any {
+	switch {
+	case math.IsInf(v, 1):
+		return "Infinity"
+	case math.IsInf(v, -1):
+		return "-Infinity"
+	}
+	return v
+}
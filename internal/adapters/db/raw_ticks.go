@@ -0,0 +1,161 @@
+package db
+
+import (
+	"marketflow/internal/domain"
+	"marketflow/pkg/logger"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Number of batches queued for writing before new ticks are dropped
+const rawTickQueue = 1024
+
+type rawTick struct {
+	data     domain.Data
+	received time.Time
+}
+
+// RawTickWriter stores every received tick into the partitioned RawTicks table.
+// Ticks are queued and written in batches with COPY, so recording never blocks ingestion.
+type RawTickWriter struct {
+	repo          *PostgresRepository
+	queue         chan []rawTick
+	batchSize     int
+	flushInterval time.Duration
+	dropped       int64
+	mu            sync.Mutex
+	closeOnce     sync.Once
+	done          chan struct{}
+}
+
+// Static check to ensure that RawTickWriter implements TickRecorder interface
+var _ domain.TickRecorder = (*RawTickWriter)(nil)
+
+func (repo *PostgresRepository) NewRawTickWriter(batchSize int, flushInterval time.Duration) *RawTickWriter {
+	w := &RawTickWriter{
+		repo:          repo,
+		queue:         make(chan []rawTick, rawTickQueue),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		done:          make(chan struct{}),
+	}
+
+	go w.run()
+	return w
+}
+
+// Record queues the ticks for writing, they are dropped if the queue is full
+func (w *RawTickWriter) Record(ticks []domain.Data) {
+	now := time.Now()
+	batch := make([]rawTick, 0, len(ticks))
+	for _, data := range ticks {
+		batch = append(batch, rawTick{data: data, received: now})
+	}
+
+	select {
+	case w.queue <- batch:
+	default:
+		w.mu.Lock()
+		w.dropped += int64(len(batch))
+		dropped := w.dropped
+		w.mu.Unlock()
+		logger.Warn("Raw tick queue is full, dropping ticks", "count", len(batch), "dropped_total", dropped)
+	}
+}
+
+// Close writes the queued ticks and stops the writer
+func (w *RawTickWriter) Close() {
+	w.closeOnce.Do(func() {
+		close(w.queue)
+		<-w.done
+	})
+}
+
+func (w *RawTickWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	pending := make([]rawTick, 0, w.batchSize)
+	for {
+		select {
+		case batch, ok := <-w.queue:
+			if !ok {
+				w.flush(pending)
+				return
+			}
+
+			pending = append(pending, batch...)
+			if len(pending) >= w.batchSize {
+				w.flush(pending)
+				pending = make([]rawTick, 0, w.batchSize)
+			}
+		case <-ticker.C:
+			if len(pending) == 0 {
+				continue
+			}
+			w.flush(pending)
+			pending = make([]rawTick, 0, w.batchSize)
+		}
+	}
+}
+
+func (w *RawTickWriter) flush(ticks []rawTick) {
+	if len(ticks) == 0 {
+		return
+	}
+
+	if err := w.copyTicks(ticks); err != nil {
+		logger.Error("Failed to write raw ticks", "count", len(ticks), "error", err.Error())
+	}
+}
+
+func (w *RawTickWriter) copyTicks(ticks []rawTick) error {
+	for _, tick := range ticks {
+		if err := w.ensurePartition(tick.received); err != nil {
+			return err
+		}
+	}
+
+	tx, err := w.repo.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(pq.CopyIn("rawticks", "exchange", "pair_name", "price", "exchangetime", "receivedtime"))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, tick := range ticks {
+		if _, err := stmt.Exec(tick.data.ExchangeName, tick.data.Symbol, tick.data.Price, tick.data.Timestamp, tick.received); err != nil {
+			stmt.Close()
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// Empty Exec flushes the COPY buffer
+	if _, err := stmt.Exec(); err != nil {
+		stmt.Close()
+		tx.Rollback()
+		return err
+	}
+
+	if err := stmt.Close(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Creates the daily partition holding t, once per day and process
+func (w *RawTickWriter) ensurePartition(t time.Time) error {
+	day := t.UTC().Truncate(24 * time.Hour)
+	return w.repo.ensurePartition("RawTicks", "rawticks_"+day.Format("20060102"), day, day.Add(24*time.Hour))
+}
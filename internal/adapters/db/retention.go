@@ -0,0 +1,444 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"marketflow/internal/domain"
+	"marketflow/pkg/config"
+	"marketflow/pkg/logger"
+	"marketflow/pkg/metrics"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Origin the rollup buckets are aligned to, the same one the candle and history queries bin by
+var rollupOrigin = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Columns AggregatedData and AggregatedRollups have in common
+const aggregateColumns = "Pair_name, Exchange, StoredTime, Average_price, Min_price, Max_price, Tick_count, Price_sum, Partial"
+
+// Retention tiers of the stored aggregates and how far each of them is rolled up
+type retention struct {
+	base        time.Duration // retention of the window rows, 0 keeps them forever
+	tiers       []config.RetentionTier
+	mu          sync.RWMutex
+	rolledUntil []time.Time // end of the last rolled up bucket of every tier, zero while it has none
+}
+
+// Compactor rolls the stored aggregates up into the retention tiers and deletes rows past their retention.
+// Rows are only deleted once the next tier has rolled them up.
+type Compactor struct {
+	repo      *PostgresRepository
+	interval  time.Duration
+	stop      chan struct{}
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// NewCompactor starts compacting every interval. The queries of the repository read the rollups from then on.
+func (repo *PostgresRepository) NewCompactor(cfg *config.RetentionConfig) *Compactor {
+	ret := &retention{
+		base:        cfg.Base,
+		tiers:       cfg.Tiers,
+		rolledUntil: make([]time.Time, len(cfg.Tiers)),
+	}
+
+	c := &Compactor{
+		repo:     repo,
+		interval: cfg.Interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	// Queries must not read pruned window rows for tiers they do not know are rolled up
+	for i := range ret.tiers {
+		if err := c.refresh(ret, i); err != nil {
+			logger.Error("Failed to read retention tier", "resolution", ret.tiers[i].Resolution.String(), "error", err.Error())
+		}
+	}
+	repo.retention = ret
+
+	go c.run()
+	return c
+}
+
+// Close waits for a running compaction and stops the compactor
+func (c *Compactor) Close() {
+	c.closeOnce.Do(func() {
+		close(c.stop)
+		<-c.done
+	})
+}
+
+func (c *Compactor) run() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.compact(time.Now()); err != nil {
+			logger.Error("Retention compaction failed", "error", err.Error())
+		}
+
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Compactor) compact(now time.Time) error {
+	ret := c.repo.retention
+	pending, err := c.pending()
+	if err != nil {
+		return fmt.Errorf("failed to read pending rollups: %w", err)
+	}
+
+	// Every tier is done before the next coarser one reads it
+	for i := range ret.tiers {
+		if err := c.rollup(ret, i, now); err != nil {
+			return fmt.Errorf("failed to roll up to %s: %w", ret.tiers[i].Resolution, err)
+		}
+		for _, bucket := range ret.pendingBuckets(i, pending, now) {
+			if err := c.rollupRange(ret, i, bucket, bucket.Add(ret.tiers[i].Resolution)); err != nil {
+				return fmt.Errorf("failed to roll up late rows to %s: %w", ret.tiers[i].Resolution, err)
+			}
+		}
+	}
+
+	if err := c.clearPending(pending); err != nil {
+		return fmt.Errorf("failed to clear pending rollups: %w", err)
+	}
+
+	for level := 0; level <= len(ret.tiers); level++ {
+		if err := c.prune(ret, level, now); err != nil {
+			return fmt.Errorf("failed to delete expired rows: %w", err)
+		}
+	}
+	return nil
+}
+
+// Rolls the closed buckets of the tier up from the next finer one. The last rolled up bucket
+// is rolled up again, it may have taken rows after its previous rollup.
+func (c *Compactor) rollup(ret *retention, i int, now time.Time) error {
+	tier := ret.tiers[i]
+
+	from := ret.until(i)
+	if !from.IsZero() {
+		from = from.Add(-tier.Resolution)
+	}
+
+	// Windows of the last bucket are flushed up to the allowed lateness after it ended
+	cutoff := binStart(now.Add(-domain.AllowedLateness), tier.Resolution)
+	if i > 0 {
+		finer := ret.until(i - 1)
+		if finer.IsZero() {
+			return nil
+		}
+		cutoff = minTime(cutoff, binStart(finer, tier.Resolution))
+	}
+
+	if !cutoff.After(from) {
+		return nil
+	}
+
+	if err := c.rollupRange(ret, i, from, cutoff); err != nil {
+		return err
+	}
+	return c.refresh(ret, i)
+}
+
+// Rolls the buckets of the tier in [from, to) up from the next finer level, replacing their previous rollup
+func (c *Compactor) rollupRange(ret *retention, i int, from, to time.Time) error {
+	tier := ret.tiers[i]
+	source := "AggregatedData"
+	if i > 0 {
+		source = fmt.Sprintf("(SELECT %s FROM AggregatedRollups WHERE Resolution = %d) AS Source", aggregateColumns, seconds(ret.tiers[i-1].Resolution))
+	}
+
+	res, err := c.repo.db.Exec(fmt.Sprintf(`
+INSERT INTO AggregatedRollups(Resolution, %s)
+SELECT
+    $1, Pair_name, Exchange,
+    date_bin($2::interval, StoredTime, TIMESTAMPTZ '2000-01-01 00:00:00+00') AS Bucket,
+    COALESCE(SUM(Price_sum) / NULLIF(SUM(Tick_count), 0), AVG(Average_price)),
+    MIN(Min_price),
+    MAX(Max_price),
+    SUM(Tick_count),
+    SUM(Price_sum),
+    BOOL_OR(Partial)
+FROM %s
+WHERE StoredTime >= $3 AND StoredTime < $4
+GROUP BY Pair_name, Exchange, Bucket
+ON CONFLICT (Resolution, Exchange, Pair_name, StoredTime) DO UPDATE
+SET Average_price = EXCLUDED.Average_price,
+    Min_price = EXCLUDED.Min_price,
+    Max_price = EXCLUDED.Max_price,
+    Tick_count = EXCLUDED.Tick_count,
+    Price_sum = EXCLUDED.Price_sum,
+    Partial = EXCLUDED.Partial;
+	`, aggregateColumns, source), seconds(tier.Resolution), fmt.Sprintf("%d seconds", seconds(tier.Resolution)), from, to)
+	if err != nil {
+		return err
+	}
+
+	if rows, err := res.RowsAffected(); err == nil {
+		metrics.RetentionRolledUp.WithLabelValues(tier.Resolution.String()).Add(float64(rows))
+	}
+	return nil
+}
+
+// Window rows saved after the rollup of their bucket, marked by markPending
+type pendingRollup struct {
+	storedTime time.Time
+	markedAt   time.Time
+}
+
+func (c *Compactor) pending() ([]pendingRollup, error) {
+	rows, err := c.repo.db.Query(`SELECT StoredTime, MarkedAt FROM RollupPending;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pending := make([]pendingRollup, 0)
+	for rows.Next() {
+		var p pendingRollup
+		if err := rows.Scan(&p.storedTime, &p.markedAt); err != nil {
+			return nil, err
+		}
+		pending = append(pending, p)
+	}
+	return pending, rows.Err()
+}
+
+// Removes the rolled up marks, those marked again in the meantime are kept for the next run
+func (c *Compactor) clearPending(pending []pendingRollup) error {
+	for _, p := range pending {
+		if _, err := c.repo.db.Exec(`DELETE FROM RollupPending WHERE StoredTime = $1 AND MarkedAt = $2;`, p.storedTime, p.markedAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Marks the window rows a rollup may already have passed, in the transaction saving them
+func (repo *PostgresRepository) markPending(tx *sql.Tx, aggregatedData map[string]domain.ExchangeData) error {
+	ret := repo.retention
+	if ret == nil || len(ret.tiers) == 0 {
+		return nil
+	}
+
+	// The cutoff of a rollup running right now
+	closed := binStart(time.Now().Add(-domain.AllowedLateness), ret.tiers[0].Resolution)
+	marked := make(map[time.Time]bool)
+	for _, data := range aggregatedData {
+		at := data.Timestamp.UTC()
+		if !at.Before(closed) || marked[at] {
+			continue
+		}
+		marked[at] = true
+
+		if _, err := tx.Exec(`
+			INSERT INTO RollupPending (StoredTime) VALUES ($1)
+			ON CONFLICT (StoredTime) DO UPDATE SET MarkedAt = NOW();
+			`, at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deletes the rows of a level past its retention, level 0 being the window rows and i+1 the tier i
+func (c *Compactor) prune(ret *retention, level int, now time.Time) error {
+	keep, resolution := ret.kept(level), domain.AggregationWindow
+	if level > 0 {
+		resolution = ret.tiers[level-1].Resolution
+	}
+	if keep == 0 {
+		return nil
+	}
+
+	before := now.Add(-keep)
+	if level < len(ret.tiers) {
+		// The last rolled up bucket of the next tier is rolled up again
+		until := ret.until(level)
+		if until.IsZero() {
+			return nil
+		}
+		before = minTime(before, until.Add(-ret.tiers[level].Resolution))
+	}
+
+	var (
+		rows int64
+		err  error
+	)
+	if level == 0 {
+		rows, err = c.exec(`DELETE FROM AggregatedData WHERE StoredTime < $1;`, before)
+	} else {
+		rows, err = c.exec(`DELETE FROM AggregatedRollups WHERE Resolution = $1 AND StoredTime < $2;`, seconds(resolution), before)
+	}
+	if err != nil {
+		return err
+	}
+
+	if rows > 0 {
+		logger.Info("Deleted expired aggregates", "resolution", resolution.String(), "rows", rows, "before", before.Format(time.RFC3339))
+	}
+	metrics.RetentionDeleted.WithLabelValues(resolution.String()).Add(float64(rows))
+	return nil
+}
+
+func (c *Compactor) exec(query string, args ...any) (int64, error) {
+	res, err := c.repo.db.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Reads how far the tier is rolled up
+func (c *Compactor) refresh(ret *retention, i int) error {
+	var last *time.Time
+	err := c.repo.db.QueryRow(`SELECT MAX(StoredTime) FROM AggregatedRollups WHERE Resolution = $1;`, seconds(ret.tiers[i].Resolution)).Scan(&last)
+	if err != nil {
+		return err
+	}
+
+	if last != nil {
+		ret.mu.Lock()
+		ret.rolledUntil[i] = last.Add(ret.tiers[i].Resolution)
+		ret.mu.Unlock()
+	}
+	return nil
+}
+
+// Buckets of the tier to roll up again for the pending rows, oldest first. Buckets from the last rolled up
+// one on are rolled up anyway, those holding rows the finer level may have deleted can not be rolled up again.
+func (r *retention) pendingBuckets(i int, pending []pendingRollup, now time.Time) []time.Time {
+	resolution := r.tiers[i].Resolution
+	until := r.until(i)
+	if until.IsZero() {
+		return nil
+	}
+
+	var oldest time.Time
+	if keep := r.kept(i); keep > 0 {
+		oldest = binStart(now.Add(-keep).Add(resolution-1), resolution)
+	}
+
+	seen := make(map[time.Time]bool)
+	buckets := make([]time.Time, 0)
+	for _, p := range pending {
+		bucket := binStart(p.storedTime, resolution)
+		if seen[bucket] || !bucket.Before(until.Add(-resolution)) {
+			continue
+		}
+		seen[bucket] = true
+
+		if bucket.Before(oldest) {
+			logger.Warn("Late aggregates past the retention are not rolled up", "resolution", resolution.String(), "bucket", bucket.Format(time.RFC3339))
+			continue
+		}
+		buckets = append(buckets, bucket)
+	}
+	sort.Slice(buckets, func(a, b int) bool { return buckets[a].Before(buckets[b]) })
+	return buckets
+}
+
+// Retention of a level, 0 being the window rows and i+1 the tier i
+func (r *retention) kept(level int) time.Duration {
+	if level == 0 {
+		return r.base
+	}
+	return r.tiers[level-1].Retention
+}
+
+func (r *retention) until(i int) time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rolledUntil[i]
+}
+
+// The finest level still keeping rows at from, 0 being the window rows and i+1 the tier i.
+// The zero time asks for all rows and takes the coarsest level.
+func (r *retention) level(from, now time.Time) int {
+	if !from.IsZero() && (r.base == 0 || !from.Before(now.Add(-r.base))) {
+		return 0
+	}
+
+	for i, tier := range r.tiers {
+		if tier.Retention == 0 || (!from.IsZero() && !from.Before(now.Add(-tier.Retention))) {
+			return i + 1
+		}
+	}
+	return len(r.tiers)
+}
+
+// Table expression of the aggregates from the level keeping rows at from. Where that level is not
+// rolled up yet the rows are read from the finer levels, down to the window rows.
+func (r *retention) source(from, now time.Time) string {
+	level := r.level(from, now)
+	if level == 0 {
+		return "AggregatedData"
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	parts := make([]string, 0, level+1)
+	var lower time.Time
+	for i := level - 1; i >= 0; i-- {
+		until := r.rolledUntil[i]
+		if until.IsZero() || !until.After(lower) {
+			continue
+		}
+
+		cond := fmt.Sprintf("Resolution = %d AND StoredTime < %s", seconds(r.tiers[i].Resolution), timestamp(until))
+		if !lower.IsZero() {
+			cond += " AND StoredTime >= " + timestamp(lower)
+		}
+		parts = append(parts, fmt.Sprintf("SELECT %s FROM AggregatedRollups WHERE %s", aggregateColumns, cond))
+		lower = until
+	}
+
+	if len(parts) == 0 {
+		return "AggregatedData"
+	}
+
+	parts = append(parts, fmt.Sprintf("SELECT %s FROM AggregatedData WHERE StoredTime >= %s", aggregateColumns, timestamp(lower)))
+	return "(" + strings.Join(parts, " UNION ALL ") + ") AS AggregatedData"
+}
+
+// Table expression of the stored aggregates for a query reaching back to from, the zero time for all of them.
+// Without retention tiers it is the AggregatedData table.
+func (repo *PostgresRepository) aggregatesSince(from time.Time) string {
+	if repo.retention == nil {
+		return "AggregatedData"
+	}
+	return repo.retention.source(from, time.Now())
+}
+
+// Start of the bucket of the given resolution holding t
+func binStart(t time.Time, resolution time.Duration) time.Time {
+	return rollupOrigin.Add(t.Sub(rollupOrigin) / resolution * resolution)
+}
+
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
+
+func seconds(d time.Duration) int64 {
+	return int64(d / time.Second)
+}
+
+func timestamp(t time.Time) string {
+	return "TIMESTAMPTZ '" + t.UTC().Format(time.RFC3339Nano) + "'"
+}
@@ -0,0 +1,150 @@
+package db
+
+import (
+	"marketflow/pkg/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+func testRetention(rolledUntil ...time.Time) *retention {
+	return &retention{
+		base: 7 * day,
+		tiers: []config.RetentionTier{
+			{Resolution: time.Hour, Retention: 90 * day},
+			{Resolution: day},
+		},
+		rolledUntil: rolledUntil,
+	}
+}
+
+func TestRetentionLevel(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	r := testRetention(time.Time{}, time.Time{})
+
+	tests := []struct {
+		from time.Time
+		want int
+	}{
+		{now.Add(-time.Hour), 0},
+		{now.Add(-7 * day), 0},
+		{now.Add(-8 * day), 1},
+		{now.Add(-90 * day), 1},
+		{now.Add(-365 * day), 2},
+		{time.Time{}, 2},
+	}
+	for _, tt := range tests {
+		if got := r.level(tt.from, now); got != tt.want {
+			t.Errorf("level(%s) = %d, want %d", now.Sub(tt.from), got, tt.want)
+		}
+	}
+}
+
+func TestRetentionPendingBuckets(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 30, 0, 0, time.UTC)
+	hours := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	days := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	pending := make([]pendingRollup, 0)
+	for _, at := range []time.Time{
+		// The last rolled up hour is rolled up anyway
+		time.Date(2025, 3, 1, 11, 10, 0, 0, time.UTC),
+		time.Date(2025, 3, 1, 9, 40, 0, 0, time.UTC),
+		time.Date(2025, 3, 1, 9, 5, 0, 0, time.UTC),
+		time.Date(2025, 2, 28, 23, 59, 0, 0, time.UTC),
+		// Past the 7 days the window rows are kept
+		time.Date(2025, 2, 20, 10, 0, 0, 0, time.UTC),
+	} {
+		pending = append(pending, pendingRollup{storedTime: at})
+	}
+
+	equal := func(got, want []time.Time) bool {
+		if len(got) != len(want) {
+			return false
+		}
+		for i := range want {
+			if !got[i].Equal(want[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	r := testRetention(hours, days)
+	want := []time.Time{time.Date(2025, 2, 28, 23, 0, 0, 0, time.UTC), time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)}
+	if got := r.pendingBuckets(0, pending, now); !equal(got, want) {
+		t.Errorf("hourly buckets = %v, want %v", got, want)
+	}
+
+	// The hourly rows are kept for 90 days, the last two days are rolled up anyway
+	want = []time.Time{time.Date(2025, 2, 20, 0, 0, 0, 0, time.UTC)}
+	if got := r.pendingBuckets(1, pending, now); !equal(got, want) {
+		t.Errorf("daily buckets = %v, want %v", got, want)
+	}
+
+	// Nothing rolled up yet, the rollup takes everything
+	if got := testRetention(time.Time{}, time.Time{}).pendingBuckets(0, pending, now); len(got) != 0 {
+		t.Errorf("buckets without rollups = %v, want none", got)
+	}
+}
+
+func TestRetentionSource(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	hours := time.Date(2025, 3, 1, 11, 0, 0, 0, time.UTC)
+	days := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	// Recent periods read the window rows only
+	if got := testRetention(hours, days).source(now.Add(-time.Hour), now); got != "AggregatedData" {
+		t.Errorf("source of the last hour = %q, want AggregatedData", got)
+	}
+
+	// Nothing rolled up yet, the window rows are all there is
+	if got := testRetention(time.Time{}, time.Time{}).source(time.Time{}, now); got != "AggregatedData" {
+		t.Errorf("source without rollups = %q, want AggregatedData", got)
+	}
+
+	// Daily rows up to the last rolled up day, then hourly rows, then the window rows
+	got := testRetention(hours, days).source(time.Time{}, now)
+	parts := strings.Split(got, " UNION ALL ")
+	want := []string{
+		"Resolution = 86400 AND StoredTime < " + timestamp(days),
+		"Resolution = 3600 AND StoredTime < " + timestamp(hours) + " AND StoredTime >= " + timestamp(days),
+		"FROM AggregatedData WHERE StoredTime >= " + timestamp(hours),
+	}
+	if len(parts) != len(want) {
+		t.Fatalf("source = %q, want %d parts", got, len(want))
+	}
+	for i := range want {
+		if !strings.Contains(parts[i], want[i]) {
+			t.Errorf("part %d = %q, want it to contain %q", i, parts[i], want[i])
+		}
+	}
+
+	// A year back reads the daily tier, but without daily rows the hourly ones stand in
+	got = testRetention(hours, time.Time{}).source(now.Add(-365*day), now)
+	if parts := strings.Split(got, " UNION ALL "); len(parts) != 2 || !strings.HasSuffix(parts[0], "Resolution = 3600 AND StoredTime < "+timestamp(hours)) {
+		t.Errorf("source = %q, want hourly rows followed by the window rows", got)
+	}
+}
+
+func TestBinStart(t *testing.T) {
+	at := time.Date(2025, 3, 1, 12, 34, 56, 0, time.UTC)
+
+	tests := []struct {
+		resolution time.Duration
+		want       time.Time
+	}{
+		{time.Minute, time.Date(2025, 3, 1, 12, 34, 0, 0, time.UTC)},
+		{time.Hour, time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)},
+		{day, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)},
+		// Saturday, like the origin
+		{7 * day, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := binStart(at, tt.resolution); !got.Equal(tt.want) {
+			t.Errorf("binStart(%s) = %s, want %s", tt.resolution, got, tt.want)
+		}
+	}
+}
@@ -3,9 +3,13 @@ package db
 import (
 	"marketflow/internal/domain"
 	"marketflow/pkg/logger"
+	"marketflow/pkg/metrics"
+	"time"
 )
 
-func (repo *PostgresRepository) SaveLatestData(latestData map[string]domain.Data) error {
+func (repo *PostgresRepository) SaveLatestData(latestData map[string]domain.Data) (err error) {
+	defer func(start time.Time) { metrics.ObserveStore(metrics.Postgres, "save_latest", start, err) }(time.Now())
+
 	tx, err := repo.db.Begin()
 	if err != nil {
 		return err
@@ -34,15 +38,58 @@ func (repo *PostgresRepository) SaveLatestData(latestData map[string]domain.Data
 	return tx.Commit()
 }
 
-func (repo *PostgresRepository) SaveAggregatedData(aggregatedData map[string]domain.ExchangeData) error {
+func (repo *PostgresRepository) SaveAggregatedData(aggregatedData map[string]domain.ExchangeData) (err error) {
+	defer func(start time.Time) { metrics.ObserveStore(metrics.Postgres, "save_aggregated", start, err) }(time.Now())
+	return repo.saveAggregated("", aggregatedData)
+}
+
+// SaveSpooledData saves aggregates written through the spool. The batch id is stored in the same transaction
+// as the rows, so a record replayed after a crash between its save and the spool cursor update is skipped.
+func (repo *PostgresRepository) SaveSpooledData(batch string, aggregatedData map[string]domain.ExchangeData) (err error) {
+	defer func(start time.Time) { metrics.ObserveStore(metrics.Postgres, "save_aggregated", start, err) }(time.Now())
+	return repo.saveAggregated(batch, aggregatedData)
+}
+
+// Ids of spooled batches are only needed until the spool cursor moved past them
+const spooledBatchRetention = 24 * time.Hour
+
+// Inserts the window rows and merges their candles in one transaction, along with the batch id if there is one
+func (repo *PostgresRepository) saveAggregated(batch string, aggregatedData map[string]domain.ExchangeData) error {
+	for _, data := range aggregatedData {
+		if err := repo.ensureAggregatePartitions(data.Timestamp); err != nil {
+			logger.Error("Failed to create aggregate partition", "error", err.Error())
+			return err
+		}
+	}
+
 	tx, err := repo.db.Begin()
 	if err != nil {
 		return err
 	}
 
+	if batch != "" {
+		result, err := tx.Exec(`INSERT INTO SpooledBatches (Batch_id) VALUES ($1) ON CONFLICT (Batch_id) DO NOTHING;`, batch)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			tx.Rollback()
+			if err == nil {
+				logger.Info("Skipping spooled batch saved before", "batch", batch)
+			}
+			return err
+		}
+
+		if _, err := tx.Exec(`DELETE FROM SpooledBatches WHERE SavedAt < $1;`, time.Now().Add(-spooledBatchRetention)); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
 	stmt, err := tx.Prepare(`
-		INSERT INTO AggregatedData(Pair_name, Exchange, StoredTime, Average_price, Min_price, Max_price)
-		VALUES($1, $2, $3, $4, $5, $6)
+		INSERT INTO AggregatedData(Pair_name, Exchange, StoredTime, Average_price, Min_price, Max_price, Tick_count, Price_sum, Partial)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		`)
 	if err != nil {
 		tx.Rollback()
@@ -50,14 +97,68 @@ func (repo *PostgresRepository) SaveAggregatedData(aggregatedData map[string]dom
 		return err
 	}
 	defer stmt.Close()
+
+	// Base candles of the window, merged if another flush already wrote the same window
+	candleStmt, err := tx.Prepare(`
+		INSERT INTO Candles(Pair_name, Exchange, OpenTime, Open_price, High_price, Low_price, Close_price, Tick_count)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (Exchange, Pair_name, OpenTime) DO UPDATE
+		SET High_price = GREATEST(Candles.High_price, EXCLUDED.High_price),
+		Low_price = LEAST(Candles.Low_price, EXCLUDED.Low_price),
+		Close_price = CASE WHEN $9 THEN Candles.Close_price ELSE EXCLUDED.Close_price END,
+		Tick_count = Candles.Tick_count + EXCLUDED.Tick_count;
+		`)
+	if err != nil {
+		tx.Rollback()
+		logger.Error("Failed to prepare candle statement", "error", err.Error())
+		return err
+	}
+	defer candleStmt.Close()
+
 	for _, data := range aggregatedData {
-		_, err := stmt.Exec(data.Pair_name, data.Exchange, data.Timestamp, data.Average_price, data.Min_price, data.Max_price)
+		_, err := stmt.Exec(data.Pair_name, data.Exchange, data.Timestamp, data.Average_price, data.Min_price, data.Max_price, data.Tick_count, data.Price_sum, data.Partial)
 		if err != nil {
 			tx.Rollback()
 			logger.Error("Failed to execute statement", "pair", data.Pair_name, "exchange", data.Exchange, "error", err.Error())
 			return err
 		}
+
+		if data.Tick_count == 0 {
+			continue
+		}
+
+		_, err = candleStmt.Exec(data.Pair_name, data.Exchange, data.Timestamp, data.Open_price, data.Max_price, data.Min_price, data.Close_price, data.Tick_count, data.Late)
+		if err != nil {
+			tx.Rollback()
+			logger.Error("Failed to execute candle statement", "pair", data.Pair_name, "exchange", data.Exchange, "error", err.Error())
+			return err
+		}
+	}
+	if err := repo.markPending(tx, aggregatedData); err != nil {
+		tx.Rollback()
+		logger.Error("Failed to mark late aggregates for the rollups", "error", err.Error())
+		return err
 	}
+
 	logger.Info("Committing transaction", "records", len(aggregatedData))
 	return tx.Commit()
 }
+
+// Creates the monthly AggregatedData partition holding t and the one of the next month,
+// so the first flush of a month finds its partition ready
+func (repo *PostgresRepository) ensureAggregatePartitions(t time.Time) error {
+	name, start, end := monthPartition(t)
+	if err := repo.ensurePartition("AggregatedData", name, start, end); err != nil {
+		return err
+	}
+
+	name, start, end = monthPartition(end)
+	return repo.ensurePartition("AggregatedData", name, start, end)
+}
+
+// Name and range of the monthly AggregatedData partition holding t, months are UTC
+func monthPartition(t time.Time) (string, time.Time, time.Time) {
+	t = t.UTC()
+	start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return "aggregateddata_" + start.Format("200601"), start, start.AddDate(0, 1, 0)
+}
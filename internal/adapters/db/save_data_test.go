@@ -0,0 +1,31 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMonthPartition(t *testing.T) {
+	tests := []struct {
+		at    time.Time
+		name  string
+		start time.Time
+	}{
+		{time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC), "aggregateddata_202501", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2025, 12, 31, 23, 59, 59, 0, time.UTC), "aggregateddata_202512", time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)},
+		// Still January in UTC
+		{time.Date(2025, 2, 1, 2, 0, 0, 0, time.FixedZone("UTC+5", 5*60*60)), "aggregateddata_202501", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		name, start, end := monthPartition(tt.at)
+		if name != tt.name || !start.Equal(tt.start) || !end.Equal(tt.start.AddDate(0, 1, 0)) {
+			t.Errorf("monthPartition(%s) = %s [%s, %s), want %s from %s", tt.at, name, start, end, tt.name, tt.start)
+		}
+	}
+
+	// The next partition starts where the previous one ends
+	_, _, end := monthPartition(time.Date(2025, 12, 10, 0, 0, 0, 0, time.UTC))
+	if name, _, _ := monthPartition(end); name != "aggregateddata_202601" {
+		t.Errorf("partition after December = %s, want aggregateddata_202601", name)
+	}
+}
@@ -0,0 +1,41 @@
+package exchange
+
+import (
+	"marketflow/pkg/config"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// ReconnectPolicy spaces the reconnect attempts of a live exchange by an exponential backoff
+type ReconnectPolicy struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Multiplier      float64
+	Jitter          float64 // fraction every delay is randomized by, in both directions
+	MaxAttempts     int     // 0 means unlimited
+}
+
+func NewReconnectPolicy(cfg *config.ReconnectConfig) ReconnectPolicy {
+	return ReconnectPolicy{
+		InitialInterval: cfg.InitialInterval,
+		MaxInterval:     cfg.MaxInterval,
+		Multiplier:      cfg.Multiplier,
+		Jitter:          cfg.Jitter,
+		MaxAttempts:     cfg.MaxAttempts,
+	}
+}
+
+// Delay returns the wait before the given attempt, counted from zero.
+// Jitter keeps exchanges dropped at the same time from reconnecting in lockstep.
+func (p ReconnectPolicy) Delay(attempt int) time.Duration {
+	delay := float64(p.InitialInterval) * math.Pow(p.Multiplier, float64(attempt))
+	delay = math.Min(delay, float64(p.MaxInterval))
+	delay *= 1 + p.Jitter*(2*rand.Float64()-1)
+	return time.Duration(math.Min(delay, float64(p.MaxInterval)))
+}
+
+// Allows reports whether another attempt is allowed after the given number of failed ones
+func (p ReconnectPolicy) Allows(failed int) bool {
+	return p.MaxAttempts == 0 || failed < p.MaxAttempts
+}
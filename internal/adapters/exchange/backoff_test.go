@@ -0,0 +1,41 @@
+package exchange
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReconnectPolicyDelay(t *testing.T) {
+	policy := ReconnectPolicy{InitialInterval: 100 * time.Millisecond, MaxInterval: time.Second, Multiplier: 2}
+
+	want := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for attempt, w := range want {
+		if got := policy.Delay(attempt); got != w*time.Millisecond {
+			t.Errorf("Delay(%d) = %s, want %s", attempt, got, w*time.Millisecond)
+		}
+	}
+}
+
+func TestReconnectPolicyJitter(t *testing.T) {
+	policy := ReconnectPolicy{InitialInterval: time.Second, MaxInterval: 10 * time.Second, Multiplier: 2, Jitter: 0.5}
+
+	for i := 0; i < 100; i++ {
+		if got := policy.Delay(1); got < time.Second || got > 3*time.Second {
+			t.Fatalf("Delay(1) = %s, want within [1s, 3s]", got)
+		}
+		if got := policy.Delay(10); got < 5*time.Second || got > 10*time.Second {
+			t.Fatalf("Delay(10) = %s, want within [5s, 10s]", got)
+		}
+	}
+}
+
+func TestReconnectPolicyAllows(t *testing.T) {
+	if !(ReconnectPolicy{}).Allows(1_000_000) {
+		t.Error("unlimited policy stopped allowing attempts")
+	}
+
+	capped := ReconnectPolicy{MaxAttempts: 3}
+	if !capped.Allows(2) || capped.Allows(3) {
+		t.Error("capped policy must allow exactly 3 attempts")
+	}
+}
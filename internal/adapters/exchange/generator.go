@@ -0,0 +1,73 @@
+package exchange
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Starting mid prices of the generated symbols
+var basePrices = map[string]float64{
+	"BTCUSDT": 60000.0, "DOGEUSDT": 0.15, "TONUSDT": 5.0, "SOLUSDT": 150.0, "ETHUSDT": 3000.0,
+}
+
+const yearDuration = 365 * 24 * time.Hour
+
+// PriceGenerator produces the price of a symbol quoted by an exchange at the given time.
+// It is called from a single goroutine with non-decreasing times.
+type PriceGenerator interface {
+	Next(exchange, symbol string, at time.Time) float64
+}
+
+// GBMGenerator moves a mid price per symbol by geometric Brownian motion,
+// every exchange quotes it with its own small constant spread
+type GBMGenerator struct {
+	rng        *rand.Rand
+	drift      float64 // annualized
+	volatility float64 // annualized
+	spreadBps  float64
+	mids       map[string]float64
+	updated    map[string]time.Time
+	spreads    map[string]float64
+}
+
+// Static check to ensure that GBMGenerator implements PriceGenerator interface
+var _ PriceGenerator = (*GBMGenerator)(nil)
+
+func NewGBMGenerator(seed int64, drift, volatility, spreadBps float64) *GBMGenerator {
+	return &GBMGenerator{
+		rng:        rand.New(rand.NewSource(seed)),
+		drift:      drift,
+		volatility: volatility,
+		spreadBps:  spreadBps,
+		mids:       make(map[string]float64),
+		updated:    make(map[string]time.Time),
+		spreads:    make(map[string]float64),
+	}
+}
+
+func (g *GBMGenerator) Next(exchange, symbol string, at time.Time) float64 {
+	mid, ok := g.mids[symbol]
+	if !ok {
+		mid, ok = basePrices[symbol]
+		if !ok {
+			mid = 1
+		}
+	}
+
+	// S(t+dt) = S(t) * exp((mu - sigma^2/2)dt + sigma*sqrt(dt)*Z)
+	if last, ok := g.updated[symbol]; ok && at.After(last) {
+		dt := float64(at.Sub(last)) / float64(yearDuration)
+		mid *= math.Exp((g.drift-g.volatility*g.volatility/2)*dt + g.volatility*math.Sqrt(dt)*g.rng.NormFloat64())
+	}
+	g.mids[symbol] = mid
+	g.updated[symbol] = at
+
+	spread, ok := g.spreads[exchange]
+	if !ok {
+		spread = (g.rng.Float64()*2 - 1) * g.spreadBps / 10000
+		g.spreads[exchange] = spread
+	}
+
+	return mid * (1 + spread)
+}
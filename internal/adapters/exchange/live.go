@@ -3,35 +3,48 @@ package exchange
 import (
 	"bufio"
 	"errors"
+	"fmt"
 	"marketflow/internal/adapters/service"
 	"marketflow/internal/domain"
 	"marketflow/pkg/config"
 	"marketflow/pkg/logger"
 	"net"
-	"strconv"
 	"sync"
 	"time"
 )
 
+var errExchangeClosed = errors.New("exchange is closed")
+
 type Exchange struct {
 	number      string
+	address     string
 	conn        net.Conn
-	closeCh     chan bool
+	connMu      sync.Mutex
+	closeCh     chan struct{}
+	closeOnce   sync.Once
 	messageChan chan string
+	recorder    domain.LineRecorder
+	policy      ReconnectPolicy
+	state       string // guarded by connMu
+	attempts    int    // reconnect attempts since the last message, only used by FetchData
+	stats       exchangeStats
 }
 
 type LiveMode struct {
 	Exchanges []*Exchange
+	recorder  domain.LineRecorder
 	mu        sync.Mutex
 }
 
-func NewLiveModeFetcher() *LiveMode {
-	return &LiveMode{Exchanges: make([]*Exchange, 0)}
+// Static check to ensure that LiveMode reports the health of its exchanges
+var _ domain.ExchangeHealthReporter = (*LiveMode)(nil)
+
+// NewLiveModeFetcher returns a live fetcher, every line read from the exchanges is passed to the recorder if it is not nil
+func NewLiveModeFetcher(recorder domain.LineRecorder) *LiveMode {
+	return &LiveMode{Exchanges: make([]*Exchange, 0), recorder: recorder}
 }
 
 func (m *LiveMode) SetupDataFetcher() (chan map[string]domain.ExchangeData, chan []domain.Data, error) {
-	dataFlows := [3]chan domain.Data{make(chan domain.Data), make(chan domain.Data), make(chan domain.Data)}
-
 	wg := &sync.WaitGroup{}
 
 	exchangeConfig, err := config.LoadExchangeConfig()
@@ -40,61 +53,81 @@ func (m *LiveMode) SetupDataFetcher() (chan map[string]domain.ExchangeData, chan
 		return nil, nil, err
 	}
 
+	reconnectConfig, err := config.LoadReconnectConfig()
+	if err != nil {
+		logger.Error("Error loading reconnect config", "error", err)
+		return nil, nil, err
+	}
+	policy := NewReconnectPolicy(reconnectConfig)
+
+	names := exchangeConfig.Names
 	ports := exchangeConfig.Ports
 	exchHosts := exchangeConfig.ExchHosts
 
-	for i := 0; i < len(ports); i++ {
-		wg.Add(1)
-		exch, err := GenerateExchange("Exchange"+strconv.Itoa(i+1), exchHosts[i]+":"+ports[i])
+	dataFlows := make([]chan domain.Data, 0, len(names))
+
+	m.mu.Lock()
+	for i := 0; i < len(names); i++ {
+		exch, err := GenerateExchange(names[i], net.JoinHostPort(exchHosts[i], ports[i]))
 		if err != nil {
-			logger.Error("Failed to connect exchange number: %d, error: %s", i+1, err.Error())
-			wg.Done()
-			continue
+			// The exchange keeps trying to reconnect in FetchData, the others work without it
+			logger.Warn("Failed to connect exchange, running in degraded state", "Exchange name", names[i], "error", err.Error())
 		}
 
+		exch.recorder = m.recorder
+		exch.policy = policy
+
+		dataFlow := make(chan domain.Data)
+		dataFlows = append(dataFlows, dataFlow)
+
+		wg.Add(1)
 		// Receive data from the server
 		go exch.FetchData(wg)
 
 		// Start the worker to process the received data
-		go exch.SetWorkers(wg, dataFlows[i])
+		go exch.SetWorkers(wg, dataFlow)
 
 		m.Exchanges = append(m.Exchanges, exch)
 	}
+	m.mu.Unlock()
 
-	if len(m.Exchanges) != 3 {
-		return nil, nil, errors.New("failed to connect to 3 exchanges")
-	}
-
-	mergedCh := service.FanIn(dataFlows)
+	mergedCh := service.FanIn(dataFlows, domain.BatchInterval)
 
-	aggregatedChan, rawDataChan := service.Aggregate(mergedCh)
+	aggregatedChan, rawDataChan := service.Aggregate(service.Validate(mergedCh))
 
 	go func() {
 		wg.Wait()
+		m.mu.Lock()
 		for i := 0; i < len(m.Exchanges); i++ {
 			if m.Exchanges[i] == nil {
 				continue
 			}
-			if m.Exchanges[i].conn != nil {
-				m.Exchanges[i].conn.Close()
-			}
+			m.Exchanges[i].closeConn()
 		}
+		m.mu.Unlock()
 
 		logger.Info("All workers have finished processing.")
 	}()
 	return aggregatedChan, rawDataChan, nil
 }
 
-// GenerateExchange returns pointer to Exchange data with messageChan
+// GenerateExchange returns pointer to Exchange data with messageChan.
+// The exchange is returned even if the connection failed, so it can be reconnected later.
 func GenerateExchange(exchangeNumber, address string) (*Exchange, error) {
-	messageChan := make(chan string)
+	exchangeServ := &Exchange{
+		number:      exchangeNumber,
+		address:     address,
+		closeCh:     make(chan struct{}),
+		messageChan: make(chan string),
+		state:       domain.ConnReconnecting,
+	}
 
 	conn, err := net.Dial("tcp", address)
 	if err != nil {
-		return nil, err
+		return exchangeServ, err
 	}
 
-	exchangeServ := &Exchange{number: exchangeNumber, conn: conn, messageChan: messageChan}
+	exchangeServ.setConn(conn)
 	return exchangeServ, nil
 }
 
@@ -105,7 +138,7 @@ func (exch *Exchange) SetWorkers(globalWg *sync.WaitGroup, fan_in chan domain.Da
 		workerWg.Add(1)
 		globalWg.Add(1)
 		go func() {
-			service.Worker(exch.number, exch.messageChan, fan_in, workerWg)
+			service.Worker(exch.number, exch.messageChan, fan_in, &exch.stats.worker, workerWg)
 			globalWg.Done()
 		}()
 	}
@@ -120,90 +153,157 @@ func (exch *Exchange) SetWorkers(globalWg *sync.WaitGroup, fan_in chan domain.Da
 func (exch *Exchange) FetchData(wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	scanner := bufio.NewScanner(exch.conn)
-	address := exch.conn.RemoteAddr().String()
-
-	closeCh := make(chan bool, 1)
-	exch.closeCh = closeCh
-
-	reconnect := true
-	mu := sync.Mutex{}
-
-	go func() {
-		<-closeCh
-		mu.Lock()
-		reconnect = false
-		mu.Unlock()
-	}()
-
 	logger.Info("Starting reading data on exchange...", "Exchange name", exch.number)
 
 	for {
-		for scanner.Scan() && reconnect {
-			line := scanner.Text()
-			exch.messageChan <- line
-		}
-
-		logger.Info("Connection lost on exchange %s. Reconnecting...\n", "Exchange name", exch.number)
+		if conn := exch.getConn(); conn != nil {
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() && !exch.closed() {
+				// The exchange is sending, a later reconnect starts over from the initial interval
+				exch.attempts = 0
+				line := scanner.Text()
+				received := time.Now()
+				exch.stats.message(received)
+				if exch.recorder != nil {
+					exch.recorder.RecordLine(exch.number, line, received)
+				}
+				exch.messageChan <- line
+			}
 
-		if reconnect {
-			if err := exch.Reconnect(address); err != nil {
-				logger.Error("Failed to reconnect exchange %s: %v", exch.number, err)
-				break
+			if err := scanner.Err(); err != nil && !exch.closed() {
+				logger.Warn("Connection lost on exchange. Reconnecting...", "Exchange name", exch.number, "error", err)
+			} else {
+				logger.Info("Connection lost on exchange. Reconnecting...", "Exchange name", exch.number)
 			}
+			exch.closeConn()
+		}
 
-			scanner = bufio.NewScanner(exch.conn)
-		} else {
+		if exch.closed() {
+			break
+		}
+
+		if err := exch.Reconnect(); err != nil {
+			logger.Error("Failed to reconnect exchange", "Exchange name", exch.number, "error", err)
 			break
 		}
 	}
 
-	logger.Info("Giving up on exchange: ", exch.number)
-	close(closeCh)
+	logger.Info("Giving up on exchange", "Exchange name", exch.number)
 	close(exch.messageChan)
 }
 
-func (exch *Exchange) Reconnect(address string) error {
+// Reconnect dials the exchange until it succeeds, the exchange is closed or the policy runs out of attempts.
+// Attempts add up until the exchange sends a message, a successful dial alone does not reset the backoff.
+func (exch *Exchange) Reconnect() error {
+	exch.setState(domain.ConnReconnecting)
+
 	var err error
-	for i := 0; i < 5; i++ {
-		time.Sleep(2 * time.Second)
-		exch.conn, err = net.Dial("tcp", address)
+	for ; exch.policy.Allows(exch.attempts); exch.attempts++ {
+		delay := exch.policy.Delay(exch.attempts)
+		select {
+		case <-exch.closeCh:
+			return errExchangeClosed
+		case <-time.After(delay):
+		}
+
+		var conn net.Conn
+		conn, err = net.Dial("tcp", exch.address)
 		if err == nil {
-			logger.Info("Reconnected to exchange: ", exch.number)
+			exch.attempts++
+			exch.setConn(conn)
+			exch.stats.reconnects.Add(1)
+			logger.Info("Reconnected to exchange", "Exchange name", exch.number, "attempts", exch.attempts)
 			return nil
 		}
-		logger.Warn("Reconnect attempt failed: ", err)
+		logger.Warn("Reconnect attempt failed", "Exchange name", exch.number, "attempt", exch.attempts+1, "error", err)
+	}
+
+	exch.setState(domain.ConnFailed)
+	if err == nil {
+		return fmt.Errorf("no message after %d attempts", exch.policy.MaxAttempts)
+	}
+	return fmt.Errorf("no connection after %d attempts: %w", exch.policy.MaxAttempts, err)
+}
+
+// Close stops reading from the exchange and closes its connection
+func (exch *Exchange) Close() {
+	exch.closeOnce.Do(func() {
+		close(exch.closeCh)
+	})
+	exch.closeConn()
+}
+
+func (exch *Exchange) closed() bool {
+	select {
+	case <-exch.closeCh:
+		return true
+	default:
+		return false
+	}
+}
+
+func (exch *Exchange) getConn() net.Conn {
+	exch.connMu.Lock()
+	defer exch.connMu.Unlock()
+	return exch.conn
+}
+
+func (exch *Exchange) setConn(conn net.Conn) {
+	exch.connMu.Lock()
+	defer exch.connMu.Unlock()
+	exch.conn = conn
+	exch.state = domain.ConnConnected
+	// Close could have happened while dialing
+	if exch.closed() {
+		exch.conn.Close()
+	}
+}
+
+func (exch *Exchange) setState(state string) {
+	exch.connMu.Lock()
+	defer exch.connMu.Unlock()
+	exch.state = state
+}
+
+// State returns the connection state of the exchange, one of the domain.Conn* states
+func (exch *Exchange) State() string {
+	exch.connMu.Lock()
+	defer exch.connMu.Unlock()
+	return exch.state
+}
+
+func (exch *Exchange) closeConn() {
+	exch.connMu.Lock()
+	defer exch.connMu.Unlock()
+	if exch.conn == nil {
+		return
+	}
+
+	if err := exch.conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		logger.Error("Failed to close connection", "Exchange name", exch.number, "error", err)
 	}
-	return err
 }
 
 func (m *LiveMode) Close() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	for i := 0; i < len(m.Exchanges); i++ {
-		if m.Exchanges[i] == nil || m.Exchanges[i].conn == nil {
-			continue
-		}
-
-		if err := m.Exchanges[i].conn.Close(); err != nil {
-			logger.Error("Failed to close connection: ", err)
+		if m.Exchanges[i] == nil {
 			continue
 		}
-
-		m.Exchanges[i].closeCh <- true
+		m.Exchanges[i].Close()
 	}
 }
 
+// Exchanges that are not connected are unhealthy, the others keep serving data
 func (m *LiveMode) CheckHealth() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	var unhealthy string
-	for i := 0; i < len(m.Exchanges); i++ {
-		select {
-		case _, ok := <-m.Exchanges[i].messageChan:
-			if !ok {
-				unhealthy += m.Exchanges[i].number + " "
-			}
-		default:
-			continue
+	for _, exch := range m.Exchanges {
+		if state := exch.State(); state != domain.ConnConnected {
+			unhealthy += exch.number + " (" + state + ") "
 		}
 	}
 	if len(unhealthy) != 0 {
@@ -211,3 +311,47 @@ func (m *LiveMode) CheckHealth() error {
 	}
 	return nil
 }
+
+// ExchangeHealth returns the connection state and ingestion stats of every exchange
+func (m *LiveMode) ExchangeHealth() []domain.ExchangeHealth {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	health := make([]domain.ExchangeHealth, 0, len(m.Exchanges))
+	for _, exch := range m.Exchanges {
+		exchHealth := domain.ExchangeHealth{
+			Name:           exch.number,
+			State:          exch.State(),
+			MessagesPerSec: exch.stats.rate.perSecond(now),
+			ParseErrors:    exch.stats.worker.ParseErrors.Load(),
+			Reconnects:     exch.stats.reconnects.Load(),
+		}
+		if skew, ok := exch.stats.worker.ClockSkew(); ok {
+			skewMs := skew.Milliseconds()
+			exchHealth.ClockSkewMs = &skewMs
+		}
+		if last := exch.stats.lastMessage.Load(); last != 0 {
+			lastMessage := time.Unix(0, last)
+			exchHealth.LastMessage = &lastMessage
+		}
+		health = append(health, exchHealth)
+	}
+	return health
+}
+
+// States returns the connection state of every exchange by name
+func (m *LiveMode) States() map[string]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	states := make(map[string]string, len(m.Exchanges))
+	for _, exch := range m.Exchanges {
+		states[exch.number] = exch.State()
+	}
+	return states
+}
+
+func (m *LiveMode) Mode() string {
+	return domain.ModeLive
+}
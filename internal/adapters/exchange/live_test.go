@@ -0,0 +1,110 @@
+package exchange
+
+import (
+	"marketflow/internal/domain"
+	"marketflow/pkg/fakeexchange"
+	"net"
+	"testing"
+	"time"
+)
+
+// Starts a live fetcher reading from the fake exchange and drains its channels until the test ends
+func startLive(t *testing.T, addr string) *LiveMode {
+	t.Helper()
+	t.Setenv("EXCHANGES", "Exchange1="+addr)
+	t.Setenv("RECONNECT_INITIAL_INTERVAL", "10ms")
+	t.Setenv("RECONNECT_MAX_INTERVAL", "50ms")
+
+	live := NewLiveModeFetcher(nil)
+	aggregated, raw, err := live.SetupDataFetcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for range aggregated {
+		}
+	}()
+	go func() {
+		for range raw {
+		}
+	}()
+	t.Cleanup(live.Close)
+	return live
+}
+
+func waitForState(t *testing.T, live *LiveMode, state string) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for live.States()["Exchange1"] != state {
+		if time.Now().After(deadline) {
+			t.Fatalf("state = %s, want %s", live.States()["Exchange1"], state)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLiveReconnects(t *testing.T) {
+	server := fakeexchange.New(fakeexchange.Config{Addr: "127.0.0.1:0", Rate: 100})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	addr := server.Addr()
+
+	live := startLive(t, addr)
+	waitForState(t, live, domain.ConnConnected)
+
+	server.DropConnections()
+	waitForState(t, live, domain.ConnReconnecting)
+	waitForState(t, live, domain.ConnConnected)
+
+	// The exchange keeps trying while it is down and recovers once it is back
+	server.Close()
+	waitForState(t, live, domain.ConnReconnecting)
+	if err := live.CheckHealth(); err == nil {
+		t.Error("CheckHealth passed while the exchange is down")
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	server = fakeexchange.New(fakeexchange.Config{Addr: addr, Rate: 100})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	waitForState(t, live, domain.ConnConnected)
+}
+
+func TestLiveGivesUpAfterMaxAttempts(t *testing.T) {
+	server := fakeexchange.New(fakeexchange.Config{Addr: "127.0.0.1:0"})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	addr := server.Addr()
+	server.Close()
+
+	t.Setenv("RECONNECT_MAX_ATTEMPTS", "2")
+	live := startLive(t, addr)
+	waitForState(t, live, domain.ConnFailed)
+}
+
+func TestLiveBacksOffConnectionsDroppedBeforeAnyMessage(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	// Every dial succeeds, yet the attempts add up since no message ever arrives
+	t.Setenv("RECONNECT_MAX_ATTEMPTS", "3")
+	live := startLive(t, listener.Addr().String())
+	waitForState(t, live, domain.ConnFailed)
+}
@@ -0,0 +1,284 @@
+package exchange
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"marketflow/internal/adapters/service"
+	"marketflow/internal/domain"
+	"marketflow/pkg/logger"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Length of the time slices read from the raw tick store at once
+const storeReadChunk = time.Minute
+
+var errReplayStopped = errors.New("replay stopped")
+
+// TickSource yields recorded ticks in order until it is exhausted or fn returns an error
+type TickSource interface {
+	ReadTicks(fn func(domain.Data) error) error
+}
+
+// ReplayMode feeds recorded ticks back through the pipeline, paced by their exchange timestamps
+type ReplayMode struct {
+	source    TickSource
+	speed     float64 // 0 replays as fast as possible
+	stop      chan struct{}
+	closeOnce sync.Once
+	mu        sync.Mutex
+	err       error
+}
+
+func NewReplayModeFetcher(source TickSource, speed float64) *ReplayMode {
+	return &ReplayMode{source: source, speed: speed, stop: make(chan struct{})}
+}
+
+// ParseReplaySpeed parses "max" or a positive multiplier like "1x", "10x" or "2.5"
+func ParseReplaySpeed(speed string) (float64, error) {
+	if speed == "" {
+		return 1, nil
+	}
+
+	if speed == "max" {
+		return 0, nil
+	}
+
+	val, err := strconv.ParseFloat(strings.TrimSuffix(speed, "x"), 64)
+	if err != nil || math.IsNaN(val) || math.IsInf(val, 0) || val <= 0 {
+		return 0, domain.ErrInvalidReplaySpeed
+	}
+	return val, nil
+}
+
+func (m *ReplayMode) SetupDataFetcher() (chan map[string]domain.ExchangeData, chan []domain.Data, error) {
+	rawFlow := make(chan []domain.Data, 100)
+
+	go m.replay(rawFlow)
+
+	aggregatedCh, rawCh := service.Aggregate(service.Validate(rawFlow))
+	return aggregatedCh, rawCh, nil
+}
+
+// Sends ticks in batches covering BatchInterval of replay time, sleeping the scaled gaps between ticks
+func (m *ReplayMode) replay(rawFlow chan []domain.Data) {
+	defer close(rawFlow)
+
+	batchMillis := domain.BatchInterval.Milliseconds()
+	var (
+		batch      []domain.Data
+		batchStart int64
+		last       int64
+		count      int
+	)
+
+	send := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		select {
+		case rawFlow <- batch:
+			batch = nil
+			return nil
+		case <-m.stop:
+			return errReplayStopped
+		}
+	}
+
+	logger.Info("Starting replay", "speed", m.speed)
+
+	err := m.source.ReadTicks(func(data domain.Data) error {
+		if len(batch) != 0 && data.Timestamp-batchStart >= batchMillis {
+			if err := send(); err != nil {
+				return err
+			}
+		}
+
+		// Ticks out of order or without a timestamp are sent right away
+		if m.speed > 0 && last != 0 && data.Timestamp > last {
+			gap := time.Duration(float64(time.Duration(data.Timestamp-last)*time.Millisecond) / m.speed)
+			select {
+			case <-time.After(gap):
+			case <-m.stop:
+				return errReplayStopped
+			}
+		}
+
+		if len(batch) == 0 {
+			batchStart = data.Timestamp
+		}
+		if data.Timestamp > last {
+			last = data.Timestamp
+		}
+
+		// Replayed ticks are aggregated into the current windows like live ones, not into the windows they were recorded in
+		data.Timestamp = time.Now().UnixMilli()
+		batch = append(batch, data)
+		count++
+		return nil
+	})
+	if err == nil {
+		err = send()
+	}
+
+	switch {
+	case errors.Is(err, errReplayStopped):
+		logger.Info("Replay stopped", "ticks", count)
+	case err != nil:
+		logger.Error("Replay failed", "ticks", count, "error", err.Error())
+		m.mu.Lock()
+		m.err = err
+		m.mu.Unlock()
+	default:
+		logger.Info("Replay finished", "ticks", count)
+	}
+}
+
+func (m *ReplayMode) Close() {
+	m.closeOnce.Do(func() {
+		close(m.stop)
+	})
+}
+
+func (m *ReplayMode) CheckHealth() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return fmt.Errorf("replay failed: %w", m.err)
+	}
+	return nil
+}
+
+func (m *ReplayMode) Mode() string {
+	return domain.ModeReplay
+}
+
+// FileTickSource reads ticks from a JSONL file, optionally gzip compressed. Every line is
+// either a price update with the exchange set, or a line written by the recorder.
+type FileTickSource struct {
+	path string
+}
+
+// NewFileTickSource opens the named file inside dir, names cannot point outside of it
+func NewFileTickSource(dir, name string) (*FileTickSource, error) {
+	if name != filepath.Base(name) || name == "." || name == ".." {
+		return nil, domain.ErrInvalidReplaySource
+	}
+
+	path := filepath.Join(dir, name)
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return nil, domain.ErrInvalidReplaySource
+	}
+
+	return &FileTickSource{path: path}, nil
+}
+
+func (s *FileTickSource) ReadTicks(fn func(domain.Data) error) error {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if strings.HasSuffix(s.path, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		data, err := parseReplayLine(line)
+		if err != nil {
+			logger.Warn("Skipping invalid replay line", "file", s.path, "line", lineNumber, "error", err.Error())
+			continue
+		}
+
+		if err := fn(data); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Recorded lines carry the raw exchange line, which does not name the exchange itself
+func parseReplayLine(line string) (domain.Data, error) {
+	var record struct {
+		domain.Data
+		Line string `json:"line"`
+	}
+	if err := json.Unmarshal([]byte(line), &record); err != nil {
+		return domain.Data{}, err
+	}
+
+	data := record.Data
+	if record.Line != "" {
+		data = domain.Data{}
+		if err := json.Unmarshal([]byte(record.Line), &data); err != nil {
+			return domain.Data{}, err
+		}
+		data.ExchangeName = record.ExchangeName
+	}
+
+	if data.ExchangeName == "" || data.Symbol == "" {
+		return domain.Data{}, errors.New("exchange or symbol is missing")
+	}
+	return data, nil
+}
+
+// StoreTickSource reads ticks received in [from, to) from the raw tick store
+type StoreTickSource struct {
+	store    domain.TickReader
+	from, to time.Time
+}
+
+func NewStoreTickSource(store domain.TickReader, from, to time.Time) *StoreTickSource {
+	return &StoreTickSource{store: store, from: from, to: to}
+}
+
+// Reads the range in short chunks, so a slow replay does not hold a query open
+func (s *StoreTickSource) ReadTicks(fn func(domain.Data) error) error {
+	for start := s.from; start.Before(s.to); start = start.Add(storeReadChunk) {
+		end := start.Add(storeReadChunk)
+		if end.After(s.to) {
+			end = s.to
+		}
+
+		ticks, err := s.store.RawTicks(start, end)
+		if err != nil {
+			return err
+		}
+
+		for _, data := range ticks {
+			if err := fn(data); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
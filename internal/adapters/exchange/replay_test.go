@@ -0,0 +1,32 @@
+package exchange
+
+import (
+	"errors"
+	"marketflow/internal/domain"
+	"testing"
+)
+
+func TestParseReplaySpeed(t *testing.T) {
+	tests := []struct {
+		speed string
+		want  float64
+		err   error
+	}{
+		{"", 1, nil},
+		{"max", 0, nil},
+		{"10x", 10, nil},
+		{"2.5", 2.5, nil},
+		{"0x", 0, domain.ErrInvalidReplaySpeed},
+		{"-1x", 0, domain.ErrInvalidReplaySpeed},
+		{"fast", 0, domain.ErrInvalidReplaySpeed},
+		{"NaN", 0, domain.ErrInvalidReplaySpeed},
+		{"Inf", 0, domain.ErrInvalidReplaySpeed},
+		{"1e400x", 0, domain.ErrInvalidReplaySpeed},
+	}
+	for _, tt := range tests {
+		got, err := ParseReplaySpeed(tt.speed)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("ParseReplaySpeed(%q) = %v, %v, want %v, %v", tt.speed, got, err, tt.want, tt.err)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"marketflow/internal/domain"
+	"marketflow/internal/domain/utils"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Scenario event types
+const (
+	EventMove      = "move"      // price moves by Change percent, linearly over Duration, and stays there
+	EventOutage    = "outage"    // exchange sends nothing during Duration
+	EventDuplicate = "duplicate" // every tick is sent Copies times during Duration
+	EventFlatline  = "flatline"  // price stays at its value from the start of the event during Duration
+)
+
+// Scenario is a list of timed events applied on top of the test mode generator
+type Scenario struct {
+	Name   string          `yaml:"name"`
+	Events []ScenarioEvent `yaml:"events"`
+
+	// Prices frozen by flatline events, by event index, exchange and symbol
+	frozen map[string]float64
+}
+
+// ScenarioEvent happens At after the start of test mode and lasts Duration.
+// Empty Exchange or Symbol means the event applies to all of them.
+type ScenarioEvent struct {
+	Type     string        `yaml:"type"`
+	At       time.Duration `yaml:"at"`
+	Duration time.Duration `yaml:"duration"`
+	Exchange string        `yaml:"exchange"`
+	Symbol   string        `yaml:"symbol"`
+	Change   float64       `yaml:"change"`
+	Copies   int           `yaml:"copies"`
+}
+
+// LoadScenario reads <name>.yaml, <name>.yml or <name>.json from dir, names cannot point outside of it
+func LoadScenario(dir, name string) (*Scenario, error) {
+	if name == "" || name != filepath.Base(name) || name == "." || name == ".." {
+		return nil, domain.ErrInvalidScenario
+	}
+
+	for _, ext := range []string{".yaml", ".yml", ".json"} {
+		content, err := os.ReadFile(filepath.Join(dir, name+ext))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// JSON is valid YAML, so one decoder reads both
+		scenario := &Scenario{}
+		if err := yaml.Unmarshal(content, scenario); err != nil {
+			return nil, fmt.Errorf("%w: %s", domain.ErrInvalidScenario, err.Error())
+		}
+
+		if err := scenario.validate(); err != nil {
+			return nil, fmt.Errorf("%w: %s", domain.ErrInvalidScenario, err.Error())
+		}
+
+		if scenario.Name == "" {
+			scenario.Name = name
+		}
+		return scenario, nil
+	}
+
+	return nil, domain.ErrScenarioNotFound
+}
+
+func (s *Scenario) validate() error {
+	if len(s.Events) == 0 {
+		return errors.New("scenario has no events")
+	}
+
+	for i := range s.Events {
+		event := &s.Events[i]
+		if event.At < 0 || event.Duration <= 0 {
+			return fmt.Errorf("event %d: at must not be negative and duration must be positive", i)
+		}
+
+		if event.Exchange != "" {
+			if err := utils.CheckExchangeName(event.Exchange); err != nil || event.Exchange == "All" {
+				return fmt.Errorf("event %d: unknown exchange %q", i, event.Exchange)
+			}
+		}
+
+		if event.Symbol != "" {
+			if err := utils.CheckSymbolName(event.Symbol); err != nil {
+				return fmt.Errorf("event %d: unknown symbol %q", i, event.Symbol)
+			}
+		}
+
+		switch event.Type {
+		case EventMove:
+			if event.Change <= -100 {
+				return fmt.Errorf("event %d: change must be greater than -100 percent", i)
+			}
+		case EventDuplicate:
+			if event.Copies == 0 {
+				event.Copies = 2
+			}
+			if event.Copies < 2 {
+				return fmt.Errorf("event %d: copies must be at least 2", i)
+			}
+		case EventOutage:
+			if event.Symbol != "" {
+				return fmt.Errorf("event %d: outage applies to whole exchanges, symbol must be empty", i)
+			}
+		case EventFlatline:
+		default:
+			return fmt.Errorf("event %d: type must be (move, outage, duplicate, flatline)", i)
+		}
+	}
+
+	s.frozen = make(map[string]float64)
+	return nil
+}
+
+func (e *ScenarioEvent) matches(exchange, symbol string) bool {
+	return (e.Exchange == "" || e.Exchange == exchange) && (e.Symbol == "" || e.Symbol == symbol)
+}
+
+func (e *ScenarioEvent) active(offset time.Duration) bool {
+	return offset >= e.At && offset < e.At+e.Duration
+}
+
+// Silent reports whether the exchange is in an outage at the offset from the scenario start
+func (s *Scenario) Silent(exchange string, offset time.Duration) bool {
+	for i := range s.Events {
+		event := &s.Events[i]
+		if event.Type == EventOutage && event.matches(exchange, "") && event.active(offset) {
+			return true
+		}
+	}
+	return false
+}
+
+// Copies returns how many times a tick is sent at the offset from the scenario start
+func (s *Scenario) Copies(exchange, symbol string, offset time.Duration) int {
+	copies := 1
+	for i := range s.Events {
+		event := &s.Events[i]
+		if event.Type == EventDuplicate && event.matches(exchange, symbol) && event.active(offset) {
+			copies = max(copies, event.Copies)
+		}
+	}
+	return copies
+}
+
+// Adjust applies the price events to a generated price at the offset from the scenario start.
+// It is called from a single goroutine with non-decreasing offsets.
+func (s *Scenario) Adjust(exchange, symbol string, offset time.Duration, price float64) float64 {
+	for i := range s.Events {
+		event := &s.Events[i]
+		if !event.matches(exchange, symbol) || offset < event.At {
+			continue
+		}
+
+		switch event.Type {
+		case EventMove:
+			progress := min(float64(offset-event.At)/float64(event.Duration), 1)
+			price *= 1 + event.Change/100*progress
+		case EventFlatline:
+			if !event.active(offset) {
+				continue
+			}
+
+			key := strconv.Itoa(i) + " " + exchange + " " + symbol
+			if frozen, ok := s.frozen[key]; ok {
+				price = frozen
+			} else {
+				s.frozen[key] = price
+			}
+		}
+	}
+	return price
+}
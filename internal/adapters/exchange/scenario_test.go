@@ -0,0 +1,193 @@
+package exchange
+
+import (
+	"errors"
+	"marketflow/internal/domain"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadScenario(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"valid.yaml":   "events:\n  - {type: move, at: 1s, duration: 2s, exchange: Exchange1, symbol: BTCUSDT, change: 10}\n",
+		"named.json":   `{"name": "renamed", "events": [{"type": "outage", "at": "0s", "duration": "1s"}]}`,
+		"broken.yaml":  "events: [type: move\n",
+		"empty.yaml":   "name: empty\n",
+		"copies.yml":   "events:\n  - {type: duplicate, at: 0s, duration: 1s}\n",
+		"negative.yml": "events:\n  - {type: flatline, at: -1s, duration: 1s}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		wantName string
+		err      error
+	}{
+		{"valid", "valid", nil},
+		{"named", "renamed", nil},
+		{"copies", "copies", nil},
+		{"missing", "", domain.ErrScenarioNotFound},
+		{"broken", "", domain.ErrInvalidScenario},
+		{"empty", "", domain.ErrInvalidScenario},
+		{"negative", "", domain.ErrInvalidScenario},
+		{"", "", domain.ErrInvalidScenario},
+		{"../valid", "", domain.ErrInvalidScenario},
+		{"..", "", domain.ErrInvalidScenario},
+	}
+	for _, tt := range tests {
+		scenario, err := LoadScenario(dir, tt.name)
+		if !errors.Is(err, tt.err) || (err != nil) != (tt.err != nil) {
+			t.Errorf("LoadScenario(%q) error = %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if err == nil && scenario.Name != tt.wantName {
+			t.Errorf("LoadScenario(%q) name = %q, want %q", tt.name, scenario.Name, tt.wantName)
+		}
+	}
+
+	// Duplicates default to two copies
+	if scenario, err := LoadScenario(dir, "copies"); err != nil || scenario.Events[0].Copies != 2 {
+		t.Errorf("copies = %+v (%v), want 2", scenario, err)
+	}
+}
+
+func TestScenarioValidate(t *testing.T) {
+	event := func(change func(e *ScenarioEvent)) ScenarioEvent {
+		e := ScenarioEvent{Type: EventMove, At: time.Second, Duration: time.Second}
+		change(&e)
+		return e
+	}
+
+	tests := []struct {
+		name  string
+		event ScenarioEvent
+		err   string
+	}{
+		{"zero duration", event(func(e *ScenarioEvent) { e.Duration = 0 }), "duration"},
+		{"unknown exchange", event(func(e *ScenarioEvent) { e.Exchange = "Exchange9" }), "unknown exchange"},
+		{"all exchanges", event(func(e *ScenarioEvent) { e.Exchange = "All" }), "unknown exchange"},
+		{"unknown symbol", event(func(e *ScenarioEvent) { e.Symbol = "XRPUSDT" }), "unknown symbol"},
+		{"move to zero", event(func(e *ScenarioEvent) { e.Change = -100 }), "change"},
+		{"single copy", event(func(e *ScenarioEvent) { e.Type, e.Copies = EventDuplicate, 1 }), "copies"},
+		{"outage of a symbol", event(func(e *ScenarioEvent) { e.Type, e.Symbol = EventOutage, domain.BTCUSDT }), "symbol must be empty"},
+		{"unknown type", event(func(e *ScenarioEvent) { e.Type = "crash" }), "type"},
+	}
+	for _, tt := range tests {
+		scenario := &Scenario{Events: []ScenarioEvent{tt.event}}
+		if err := scenario.validate(); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: error = %v, want it to mention %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestRepositoryScenariosAreValid(t *testing.T) {
+	paths, err := filepath.Glob("../../../scenarios/*")
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no scenarios found: %v", err)
+	}
+
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		if _, err := LoadScenario(filepath.Dir(path), name); err != nil {
+			t.Errorf("scenario %s: %v", name, err)
+		}
+	}
+}
+
+func TestScenarioAdjust(t *testing.T) {
+	tests := []struct {
+		name     string
+		event    ScenarioEvent
+		exchange string
+		offset   time.Duration
+		want     float64
+	}{
+		{"move not started", ScenarioEvent{Type: EventMove, At: 10 * time.Second, Duration: 10 * time.Second, Change: -20}, "Exchange1", 5 * time.Second, 100},
+		{"move half way", ScenarioEvent{Type: EventMove, At: 10 * time.Second, Duration: 10 * time.Second, Change: -20}, "Exchange1", 15 * time.Second, 90},
+		{"move done", ScenarioEvent{Type: EventMove, At: 10 * time.Second, Duration: 10 * time.Second, Change: -20}, "Exchange1", time.Minute, 80},
+		{"move elsewhere", ScenarioEvent{Type: EventMove, At: 0, Duration: time.Second, Exchange: "Exchange2", Change: 50}, "Exchange1", time.Minute, 100},
+		{"move of another symbol", ScenarioEvent{Type: EventMove, At: 0, Duration: time.Second, Symbol: domain.ETHUSDT, Change: 50}, "Exchange1", time.Minute, 100},
+		{"outage", ScenarioEvent{Type: EventOutage, At: 0, Duration: time.Minute}, "Exchange1", time.Second, 100},
+		{"duplicate", ScenarioEvent{Type: EventDuplicate, At: 0, Duration: time.Minute, Copies: 3}, "Exchange1", time.Second, 100},
+	}
+	for _, tt := range tests {
+		scenario := &Scenario{Events: []ScenarioEvent{tt.event}}
+		if err := scenario.validate(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := scenario.Adjust(tt.exchange, domain.BTCUSDT, tt.offset, 100); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: price = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestScenarioFlatline(t *testing.T) {
+	scenario := &Scenario{Events: []ScenarioEvent{{Type: EventFlatline, At: 10 * time.Second, Duration: 10 * time.Second, Exchange: "Exchange1"}}}
+	if err := scenario.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		exchange string
+		offset   time.Duration
+		price    float64
+		want     float64
+	}{
+		{"Exchange1", 5 * time.Second, 100, 100},
+		// Frozen at the first price of the event
+		{"Exchange1", 10 * time.Second, 101, 101},
+		{"Exchange1", 15 * time.Second, 110, 101},
+		{"Exchange2", 15 * time.Second, 120, 120},
+		{"Exchange1", 20 * time.Second, 130, 130},
+	}
+	for _, step := range steps {
+		if got := scenario.Adjust(step.exchange, domain.BTCUSDT, step.offset, step.price); got != step.want {
+			t.Errorf("%s at %s: price = %v, want %v", step.exchange, step.offset, got, step.want)
+		}
+	}
+}
+
+func TestScenarioOutageAndCopies(t *testing.T) {
+	scenario := &Scenario{Events: []ScenarioEvent{
+		{Type: EventOutage, At: 10 * time.Second, Duration: 10 * time.Second, Exchange: "Exchange3"},
+		{Type: EventDuplicate, At: 0, Duration: time.Minute, Symbol: domain.DOGEUSDT, Copies: 3},
+	}}
+	if err := scenario.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	silent := []struct {
+		exchange string
+		offset   time.Duration
+		want     bool
+	}{
+		{"Exchange3", 5 * time.Second, false},
+		{"Exchange3", 10 * time.Second, true},
+		{"Exchange3", 20 * time.Second, false},
+		{"Exchange1", 15 * time.Second, false},
+	}
+	for _, tt := range silent {
+		if got := scenario.Silent(tt.exchange, tt.offset); got != tt.want {
+			t.Errorf("Silent(%s, %s) = %v, want %v", tt.exchange, tt.offset, got, tt.want)
+		}
+	}
+
+	if got := scenario.Copies("Exchange1", domain.DOGEUSDT, time.Second); got != 3 {
+		t.Errorf("copies of DOGEUSDT = %d, want 3", got)
+	}
+	if got := scenario.Copies("Exchange1", domain.BTCUSDT, time.Second); got != 1 {
+		t.Errorf("copies of BTCUSDT = %d, want 1", got)
+	}
+	if got := scenario.Copies("Exchange1", domain.DOGEUSDT, 2*time.Minute); got != 1 {
+		t.Errorf("copies after the event = %d, want 1", got)
+	}
+}
@@ -0,0 +1,67 @@
+package exchange
+
+import (
+	"marketflow/internal/adapters/service"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Seconds the message rate is averaged over
+const rateWindow = 10
+
+// Ingestion stats of one exchange connection
+type exchangeStats struct {
+	lastMessage atomic.Int64        // unix nanoseconds, zero before the first message
+	worker      service.WorkerStats // parse errors and clock skew
+	reconnects  atomic.Int64
+	rate        rateCounter
+}
+
+func (s *exchangeStats) message(now time.Time) {
+	s.lastMessage.Store(now.UnixNano())
+	s.rate.add(now)
+}
+
+// Counts events in one second buckets over the last rateWindow seconds
+type rateCounter struct {
+	mu      sync.Mutex
+	buckets [rateWindow]int64
+	newest  int64 // unix second of the newest bucket
+}
+
+func (r *rateCounter) add(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sec := r.advance(now)
+	r.buckets[sec%rateWindow]++
+}
+
+// Events per second over the window
+func (r *rateCounter) perSecond(now time.Time) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.advance(now)
+
+	var sum int64
+	for _, count := range r.buckets {
+		sum += count
+	}
+	return float64(sum) / rateWindow
+}
+
+// Clears the buckets of the seconds passed since the newest one
+func (r *rateCounter) advance(now time.Time) int64 {
+	sec := now.Unix()
+	if sec-r.newest >= rateWindow {
+		r.buckets = [rateWindow]int64{}
+	} else {
+		for s := r.newest + 1; s <= sec; s++ {
+			r.buckets[s%rateWindow] = 0
+		}
+	}
+	if sec > r.newest {
+		r.newest = sec
+	}
+	return sec
+}
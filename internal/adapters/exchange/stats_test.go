@@ -0,0 +1,26 @@
+package exchange
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateCounter(t *testing.T) {
+	var r rateCounter
+	start := time.Unix(1_700_000_000, 0)
+
+	for i := 0; i < 50; i++ {
+		r.add(start.Add(time.Duration(i) * 100 * time.Millisecond))
+	}
+	if got := r.perSecond(start.Add(5 * time.Second)); got != 5 {
+		t.Errorf("rate = %v, want 5", got)
+	}
+
+	// The first three seconds leave the window
+	if got := r.perSecond(start.Add(12 * time.Second)); got != 2 {
+		t.Errorf("rate = %v, want 2", got)
+	}
+	if got := r.perSecond(start.Add(time.Minute)); got != 0 {
+		t.Errorf("rate = %v, want 0", got)
+	}
+}
@@ -1,63 +1,154 @@
 package exchange
 
 import (
+	"errors"
 	"marketflow/internal/adapters/service"
 	"marketflow/internal/domain"
+	"marketflow/pkg/config"
+	"marketflow/pkg/logger"
 	"math/rand"
+	"sync"
 	"time"
 )
 
 type TestMode struct {
-	stop chan struct{}
+	stop      chan struct{}
+	closeOnce sync.Once
+	generator PriceGenerator // nil means GBM generator built from the test mode config
+	scenario  *Scenario      // optional scripted events
+	exchanges []string
+	mu        sync.Mutex
+	started   time.Time
 }
 
 func NewTestModeFetcher() *TestMode {
 	return &TestMode{stop: make(chan struct{})}
 }
 
+// NewTestModeFetcherWithGenerator returns a test fetcher using the given generator for prices
+func NewTestModeFetcherWithGenerator(generator PriceGenerator) *TestMode {
+	return &TestMode{stop: make(chan struct{}), generator: generator}
+}
+
+// NewScenarioTestModeFetcher returns a test fetcher playing the scenario on top of the generated prices
+func NewScenarioTestModeFetcher(scenario *Scenario) *TestMode {
+	return &TestMode{stop: make(chan struct{}), scenario: scenario}
+}
+
 func (m *TestMode) SetupDataFetcher() (chan map[string]domain.ExchangeData, chan []domain.Data, error) {
-	rawFlow := make(chan []domain.Data, 100)
+	testConfig, err := config.LoadTestModeConfig()
+	if err != nil {
+		logger.Error("Error loading test mode config", "error", err)
+		return nil, nil, err
+	}
 
-	exchanges := []string{"Exchange1", "Exchange2", "Exchange3"}
-	basePrices := map[string]float64{
-		"BTCUSDT": 60000.0, "DOGEUSDT": 0.15, "TONUSDT": 5.0, "SOLUSDT": 150.0, "ETHUSDT": 3000.0,
+	// Logged, so a run with a random seed can be reproduced
+	logger.Info("Starting test mode", "seed", testConfig.Seed, "tick_interval", testConfig.TickInterval.String())
+	if m.scenario != nil {
+		logger.Info("Playing test scenario", "scenario", m.scenario.Name, "events", len(m.scenario.Events))
 	}
 
-	go func() {
-		ticker := time.NewTicker(1000 * time.Millisecond)
-		defer ticker.Stop()
+	if m.generator == nil {
+		m.generator = NewGBMGenerator(testConfig.Seed, testConfig.Drift, testConfig.Volatility, testConfig.SpreadBps)
+	}
+
+	exchanges := domain.ExchangeNames()
+	dataFlows := make([]chan domain.Data, len(exchanges))
+	for i := range dataFlows {
+		dataFlows[i] = make(chan domain.Data)
+	}
+
+	go m.generate(exchanges, dataFlows, testConfig.Seed, testConfig.TickInterval)
+
+	mergedCh := service.FanIn(dataFlows, domain.BatchInterval)
+
+	aggregatedCh, rawCh := service.Aggregate(service.Validate(mergedCh))
+	return aggregatedCh, rawCh, nil
+}
+
+// Seed of the schedule, derived from the seed of the prices so their random streams are not the same
+func scheduleSeed(seed int64) int64 {
+	return int64(uint64(seed) ^ 0x9e3779b97f4a7c15)
+}
+
+// Every exchange sends ticks of random symbols at its own randomized pace, like the live exchanges do.
+// The schedule and the prices only depend on the seed, the wall clock just paces the sending.
+func (m *TestMode) generate(exchanges []string, dataFlows []chan domain.Data, seed int64, tickInterval time.Duration) {
+	defer func() {
+		for _, flow := range dataFlows {
+			close(flow)
+		}
+	}()
+
+	rng := rand.New(rand.NewSource(scheduleSeed(seed)))
 
-		for {
+	start := time.Now()
+	m.mu.Lock()
+	m.started = start
+	m.exchanges = exchanges
+	m.mu.Unlock()
+
+	means := make([]time.Duration, len(exchanges))
+	next := make([]time.Time, len(exchanges))
+	for i := range exchanges {
+		// Some exchanges are faster than others
+		means[i] = time.Duration(float64(tickInterval) * (0.5 + rng.Float64()))
+		next[i] = start.Add(nextGap(rng, means[i]))
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		i := 0
+		for j := range next {
+			if next[j].Before(next[i]) {
+				i = j
+			}
+		}
+		at := next[i]
+
+		timer.Reset(time.Until(at))
+		select {
+		case <-m.stop:
+			return
+		case <-timer.C:
+		}
+
+		symbol := domain.Symbols[rng.Intn(len(domain.Symbols))]
+		price := m.generator.Next(exchanges[i], symbol, at)
+		next[i] = at.Add(nextGap(rng, means[i]))
+
+		copies := 1
+		if m.scenario != nil {
+			offset := at.Sub(start)
+			if m.scenario.Silent(exchanges[i], offset) {
+				continue
+			}
+			price = m.scenario.Adjust(exchanges[i], symbol, offset, price)
+			copies = m.scenario.Copies(exchanges[i], symbol, offset)
+		}
+
+		data := domain.Data{
+			ExchangeName: exchanges[i],
+			Symbol:       symbol,
+			Price:        price,
+			Timestamp:    at.UnixMilli(),
+		}
+
+		for c := 0; c < copies; c++ {
 			select {
 			case <-m.stop:
-				close(rawFlow)
 				return
-			case <-ticker.C:
-				var rawData []domain.Data
-				now := time.Now()
-
-				for i := 0; i < len(exchanges); i++ {
-					ex := exchanges[rand.Intn(len(exchanges))]
-					for _, pair := range domain.Symbols {
-						// Generate random price fluctuation (±15%)
-						price := basePrices[pair] * (1 + (rand.Float64()-0.5)*0.3)
-						rawData = append(rawData, domain.Data{
-							ExchangeName: ex,
-							Symbol:       pair,
-							Price:        price,
-							Timestamp:    now.UnixNano() / int64(time.Millisecond),
-						})
-					}
-				}
-
-				rawFlow <- rawData
-
+			case dataFlows[i] <- data:
 			}
 		}
-	}()
+	}
+}
 
-	aggregatedCh, rawCh := service.Aggregate(rawFlow)
-	return aggregatedCh, rawCh, nil
+// Exponentially distributed gap between ticks, at least a millisecond
+func nextGap(rng *rand.Rand, mean time.Duration) time.Duration {
+	return max(time.Duration(rng.ExpFloat64()*float64(mean)), time.Millisecond)
 }
 
 func AggregateFromTestMode(input chan []domain.Data) (chan map[string]domain.ExchangeData, chan []domain.Data) {
@@ -81,6 +172,8 @@ func AggregateFromTestMode(input chan []domain.Data) (chan map[string]domain.Exc
 					Average_price: d.Price,
 					Min_price:     d.Price,
 					Max_price:     d.Price,
+					Tick_count:    1,
+					Price_sum:     d.Price,
 				}
 			}
 			aggregated <- agg
@@ -91,9 +184,35 @@ func AggregateFromTestMode(input chan []domain.Data) (chan map[string]domain.Exc
 }
 
 func (g *TestMode) Close() {
-	close(g.stop)
+	g.closeOnce.Do(func() {
+		close(g.stop)
+	})
 }
 
+// Exchanges silenced by the scenario are reported the way live mode reports lost exchanges
 func (m *TestMode) CheckHealth() error {
+	m.mu.Lock()
+	started, exchanges := m.started, m.exchanges
+	m.mu.Unlock()
+
+	if m.scenario == nil || started.IsZero() {
+		return nil
+	}
+
+	var unhealthy string
+	offset := time.Since(started)
+	for _, exchange := range exchanges {
+		if m.scenario.Silent(exchange, offset) {
+			unhealthy += exchange + " "
+		}
+	}
+
+	if len(unhealthy) != 0 {
+		return errors.New("unhealthy exchanges: " + unhealthy)
+	}
 	return nil
 }
+
+func (m *TestMode) Mode() string {
+	return domain.ModeTest
+}
@@ -0,0 +1,76 @@
+package memory
+
+import (
+	"marketflow/internal/domain"
+	"sync"
+)
+
+type Cache struct {
+	mu         sync.Mutex
+	latest     map[string]domain.Data
+	aggregated map[string]domain.ExchangeData
+	err        error
+}
+
+func NewCache() *Cache {
+	return &Cache{
+		latest:     make(map[string]domain.Data),
+		aggregated: make(map[string]domain.ExchangeData),
+	}
+}
+
+// Static check to ensure that Cache implements the cache port
+var _ domain.CacheMemory = (*Cache)(nil)
+
+// Fail makes every following call return err, a nil err makes the cache work again
+func (c *Cache) Fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+}
+
+func (c *Cache) CheckHealth() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *Cache) LatestData(exchange, symbol string) (domain.Data, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return domain.Data{}, c.err
+	}
+
+	data, ok := c.latest["latest "+exchange+" "+symbol]
+	if !ok {
+		return domain.Data{}, domain.ErrCacheMiss
+	}
+	return data, nil
+}
+
+func (c *Cache) SaveLatestData(latestData map[string]domain.Data) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+
+	for key, data := range latestData {
+		c.latest[key] = data
+	}
+	return nil
+}
+
+func (c *Cache) SaveAggregatedData(aggregatedData map[string]domain.ExchangeData) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+
+	for key, data := range aggregatedData {
+		c.aggregated[key] = data
+	}
+	return nil
+}
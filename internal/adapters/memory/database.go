@@ -0,0 +1,393 @@
+// Package memory holds in-memory adapters behaving like the PostgreSQL and Redis ones,
+// used by the integration tests and for running without the containers.
+package memory
+
+import (
+	"marketflow/internal/domain"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Zero time date_bin buckets are aligned to, like in the SQL queries
+var binOrigin = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type rawTick struct {
+	data     domain.Data
+	received time.Time
+}
+
+type Database struct {
+	mu         sync.Mutex
+	latest     map[string]domain.Data
+	aggregated []domain.ExchangeData
+	candles    []domain.Candle
+	ticks      []rawTick
+	batches    map[string]bool // ids of the saved spool records
+	err        error
+}
+
+func NewDatabase() *Database {
+	return &Database{latest: make(map[string]domain.Data), batches: make(map[string]bool)}
+}
+
+// Static check to ensure that Database implements the database port and can store raw ticks
+var (
+	_ domain.Database     = (*Database)(nil)
+	_ domain.TickRecorder = (*Database)(nil)
+)
+
+// Fail makes every following call return err, a nil err makes the database work again
+func (d *Database) Fail(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.err = err
+}
+
+// Aggregated returns a copy of the stored aggregated rows
+func (d *Database) Aggregated() []domain.ExchangeData {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]domain.ExchangeData(nil), d.aggregated...)
+}
+
+func (d *Database) CheckHealth() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.err
+}
+
+func (d *Database) SaveLatestData(latestData map[string]domain.Data) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return d.err
+	}
+
+	for _, data := range latestData {
+		d.latest[data.ExchangeName+" "+data.Symbol] = data
+	}
+	return nil
+}
+
+func (d *Database) SaveAggregatedData(aggregatedData map[string]domain.ExchangeData) error {
+	return d.SaveSpooledData("", aggregatedData)
+}
+
+// SaveSpooledData saves a spool record once, a replay of a batch already saved is skipped
+func (d *Database) SaveSpooledData(batch string, aggregatedData map[string]domain.ExchangeData) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return d.err
+	}
+
+	if batch != "" {
+		if d.batches[batch] {
+			return nil
+		}
+		d.batches[batch] = true
+	}
+
+	for _, data := range aggregatedData {
+		d.aggregated = append(d.aggregated, data)
+		if data.Tick_count == 0 {
+			continue
+		}
+		d.saveCandle(data)
+	}
+	return nil
+}
+
+// Merges the window candle like the ON CONFLICT clause of the candle upsert
+func (d *Database) saveCandle(data domain.ExchangeData) {
+	for i, candle := range d.candles {
+		if candle.Exchange != data.Exchange || candle.Symbol != data.Pair_name || !candle.OpenTime.Equal(data.Timestamp) {
+			continue
+		}
+		candle.High = math.Max(candle.High, data.Max_price)
+		candle.Low = math.Min(candle.Low, data.Min_price)
+		if !data.Late {
+			candle.Close = data.Close_price
+		}
+		candle.Ticks += data.Tick_count
+		d.candles[i] = candle
+		return
+	}
+
+	d.candles = append(d.candles, domain.Candle{
+		Exchange: data.Exchange,
+		Symbol:   data.Pair_name,
+		OpenTime: data.Timestamp,
+		Open:     data.Open_price,
+		High:     data.Max_price,
+		Low:      data.Min_price,
+		Close:    data.Close_price,
+		Ticks:    data.Tick_count,
+	})
+}
+
+// Record stores raw ticks as received now
+func (d *Database) Record(ticks []domain.Data) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	received := time.Now()
+	for _, tick := range ticks {
+		d.ticks = append(d.ticks, rawTick{data: tick, received: received})
+	}
+}
+
+func (d *Database) Close() {}
+
+func (d *Database) LatestDataByExchange(exchange, symbol string) (domain.Data, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return domain.Data{}, d.err
+	}
+
+	return d.latest[exchange+" "+symbol], nil
+}
+
+func (d *Database) LatestDataByAllExchanges(symbol string) (domain.Data, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return domain.Data{}, d.err
+	}
+
+	var latest domain.Data
+	for _, data := range d.latest {
+		if data.Symbol == symbol && (latest.Price == 0 || data.Timestamp > latest.Timestamp) {
+			latest = data
+		}
+	}
+	return latest, nil
+}
+
+// Rows of one exchange and pair, all time if duration is zero, otherwise stored within [startTime-duration, startTime]
+func (d *Database) rows(exchange, symbol string, startTime time.Time, duration time.Duration) []domain.ExchangeData {
+	rows := make([]domain.ExchangeData, 0)
+	for _, data := range d.aggregated {
+		if data.Exchange != exchange || data.Pair_name != symbol {
+			continue
+		}
+		if duration != 0 && (data.Timestamp.Before(startTime.Add(-duration)) || data.Timestamp.After(startTime)) {
+			continue
+		}
+		rows = append(rows, data)
+	}
+	return rows
+}
+
+func (d *Database) average(exchange, symbol string, startTime time.Time, duration time.Duration) (domain.Data, int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return domain.Data{}, 0, d.err
+	}
+
+	data := domain.Data{ExchangeName: exchange, Symbol: symbol}
+	var sum float64
+	var ticks int64
+	for _, row := range d.rows(exchange, symbol, startTime, duration) {
+		sum += row.Price_sum
+		ticks += row.Tick_count
+	}
+	if ticks > 0 {
+		data.Price = sum / float64(ticks)
+	}
+	return data, ticks, nil
+}
+
+// Row holding the extreme price picked by better, zero price if there is none
+func (d *Database) extreme(exchange, symbol string, startTime time.Time, duration time.Duration, price func(domain.ExchangeData) float64, better func(a, b float64) bool) (domain.Data, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return domain.Data{}, d.err
+	}
+
+	data := domain.Data{ExchangeName: exchange, Symbol: symbol}
+	var found bool
+	for _, row := range d.rows(exchange, symbol, startTime, duration) {
+		if !found || better(price(row), data.Price) {
+			data.Price = price(row)
+			data.Timestamp = row.Timestamp.UnixMilli()
+			found = true
+		}
+	}
+	if !found {
+		data.Timestamp = time.Time{}.UnixMilli()
+	}
+	return data, nil
+}
+
+func minPrice(row domain.ExchangeData) float64 { return row.Min_price }
+func maxPrice(row domain.ExchangeData) float64 { return row.Max_price }
+func lower(a, b float64) bool                  { return a < b }
+func higher(a, b float64) bool                 { return a > b }
+
+func (d *Database) AveragePriceByExchange(exchange, symbol string) (domain.Data, int64, error) {
+	return d.average(exchange, symbol, time.Time{}, 0)
+}
+
+func (d *Database) AveragePriceByAllExchanges(symbol string) (domain.Data, int64, error) {
+	return d.average("All", symbol, time.Time{}, 0)
+}
+
+func (d *Database) AveragePriceWithDuration(exchange, symbol string, startTime time.Time, duration time.Duration) (domain.Data, int64, error) {
+	return d.average(exchange, symbol, startTime, duration)
+}
+
+func (d *Database) MinPriceByAllExchanges(symbol string) (domain.Data, error) {
+	return d.extreme("All", symbol, time.Time{}, 0, minPrice, lower)
+}
+
+func (d *Database) MinPriceByExchange(exchange, symbol string) (domain.Data, error) {
+	return d.extreme(exchange, symbol, time.Time{}, 0, minPrice, lower)
+}
+
+func (d *Database) MinPriceByExchangeWithDuration(exchange, symbol string, startTime time.Time, duration time.Duration) (domain.Data, error) {
+	return d.extreme(exchange, symbol, startTime, duration, minPrice, lower)
+}
+
+func (d *Database) MinPriceByAllExchangesWithDuration(symbol string, startTime time.Time, duration time.Duration) (domain.Data, error) {
+	return d.extreme("All", symbol, startTime, duration, minPrice, lower)
+}
+
+func (d *Database) MaxPriceByAllExchanges(symbol string) (domain.Data, error) {
+	return d.extreme("All", symbol, time.Time{}, 0, maxPrice, higher)
+}
+
+func (d *Database) MaxPriceByExchange(exchange, symbol string) (domain.Data, error) {
+	return d.extreme(exchange, symbol, time.Time{}, 0, maxPrice, higher)
+}
+
+func (d *Database) MaxPriceByExchangeWithDuration(exchange, symbol string, startTime time.Time, duration time.Duration) (domain.Data, error) {
+	return d.extreme(exchange, symbol, startTime, duration, maxPrice, higher)
+}
+
+func (d *Database) MaxPriceByAllExchangesWithDuration(symbol string, startTime time.Time, duration time.Duration) (domain.Data, error) {
+	return d.extreme("All", symbol, startTime, duration, maxPrice, higher)
+}
+
+// Candles of the given interval in [from, to), rolled up from the base window candles
+func (d *Database) Candles(exchange, symbol string, interval time.Duration, from, to time.Time) ([]domain.Candle, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	base := make([]domain.Candle, 0)
+	for _, candle := range d.candles {
+		if candle.Exchange == exchange && candle.Symbol == symbol && !candle.OpenTime.Before(from) && candle.OpenTime.Before(to) {
+			base = append(base, candle)
+		}
+	}
+	sort.Slice(base, func(i, j int) bool { return base[i].OpenTime.Before(base[j].OpenTime) })
+
+	candles := make([]domain.Candle, 0)
+	for _, candle := range base {
+		bucket := bin(candle.OpenTime, interval)
+		if n := len(candles); n > 0 && candles[n-1].OpenTime.Equal(bucket) {
+			last := &candles[n-1]
+			last.High = math.Max(last.High, candle.High)
+			last.Low = math.Min(last.Low, candle.Low)
+			last.Close = candle.Close
+			last.Ticks += candle.Ticks
+			continue
+		}
+		candle.OpenTime = bucket
+		candles = append(candles, candle)
+	}
+	return candles, nil
+}
+
+// Stored aggregates in [from, to), ordered by time. With a non-zero step rows are
+// grouped into step long buckets, otherwise every stored window is returned.
+func (d *Database) PriceHistory(exchange, symbol string, from, to time.Time, step time.Duration, limit, offset int) ([]domain.PricePoint, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	rows := make([]domain.ExchangeData, 0)
+	for _, data := range d.aggregated {
+		if data.Exchange == exchange && data.Pair_name == symbol && !data.Timestamp.Before(from) && data.Timestamp.Before(to) {
+			rows = append(rows, data)
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Timestamp.Before(rows[j].Timestamp) })
+
+	points := make([]domain.PricePoint, 0)
+	sums := make([]float64, 0)
+	counts := make([]int64, 0)
+	for _, row := range rows {
+		point := domain.PricePoint{
+			Timestamp:     row.Timestamp,
+			Average_price: row.Average_price,
+			Min_price:     row.Min_price,
+			Max_price:     row.Max_price,
+			Partial:       row.Partial,
+		}
+		if step == 0 {
+			points = append(points, point)
+			continue
+		}
+
+		point.Timestamp = bin(row.Timestamp, step)
+		if n := len(points); n > 0 && points[n-1].Timestamp.Equal(point.Timestamp) {
+			last := &points[n-1]
+			last.Min_price = math.Min(last.Min_price, point.Min_price)
+			last.Max_price = math.Max(last.Max_price, point.Max_price)
+			last.Partial = last.Partial || point.Partial
+			sums[n-1] += row.Price_sum
+			counts[n-1] += row.Tick_count
+			continue
+		}
+		points = append(points, point)
+		sums = append(sums, row.Price_sum)
+		counts = append(counts, row.Tick_count)
+	}
+	for i := range counts {
+		if counts[i] > 0 {
+			points[i].Average_price = sums[i] / float64(counts[i])
+		}
+	}
+
+	if offset >= len(points) {
+		return make([]domain.PricePoint, 0), nil
+	}
+	points = points[offset:]
+	if limit < len(points) {
+		points = points[:limit]
+	}
+	return points, nil
+}
+
+// Raw ticks received in [from, to), in the order they were received
+func (d *Database) RawTicks(from, to time.Time) ([]domain.Data, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	ticks := make([]domain.Data, 0)
+	for _, tick := range d.ticks {
+		if !tick.received.Before(from) && tick.received.Before(to) {
+			ticks = append(ticks, tick.data)
+		}
+	}
+	return ticks, nil
+}
+
+// Start of the interval long bucket holding t, like date_bin
+func bin(t time.Time, interval time.Duration) time.Time {
+	return binOrigin.Add(t.Sub(binOrigin) / interval * interval).In(t.Location())
+}
@@ -0,0 +1,76 @@
+package memory
+
+import (
+	"marketflow/internal/domain"
+	"testing"
+	"time"
+)
+
+func TestCandlesRollUpWindows(t *testing.T) {
+	db := NewDatabase()
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	for i, prices := range [][4]float64{{10, 12, 9, 11}, {11, 15, 11, 14}, {14, 14, 8, 9}} {
+		db.SaveAggregatedData(map[string]domain.ExchangeData{"Exchange1 BTCUSDT": {
+			Exchange:    "Exchange1",
+			Pair_name:   "BTCUSDT",
+			Timestamp:   start.Add(time.Duration(i) * time.Minute),
+			Open_price:  prices[0],
+			Max_price:   prices[1],
+			Min_price:   prices[2],
+			Close_price: prices[3],
+			Tick_count:  2,
+		}})
+	}
+
+	candles, err := db.Candles("Exchange1", "BTCUSDT", 2*time.Minute, start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []domain.Candle{
+		{Exchange: "Exchange1", Symbol: "BTCUSDT", OpenTime: start, Open: 10, High: 15, Low: 9, Close: 14, Ticks: 4},
+		{Exchange: "Exchange1", Symbol: "BTCUSDT", OpenTime: start.Add(2 * time.Minute), Open: 14, High: 14, Low: 8, Close: 9, Ticks: 2},
+	}
+	if len(candles) != len(want) {
+		t.Fatalf("got %d candles, want %d", len(candles), len(want))
+	}
+	for i := range want {
+		if candles[i] != want[i] {
+			t.Errorf("candle %d = %+v, want %+v", i, candles[i], want[i])
+		}
+	}
+}
+
+func TestPriceHistoryPages(t *testing.T) {
+	db := NewDatabase()
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		db.SaveAggregatedData(map[string]domain.ExchangeData{"All DOGEUSDT": {
+			Exchange:      "All",
+			Pair_name:     "DOGEUSDT",
+			Timestamp:     start.Add(time.Duration(i) * time.Minute),
+			Average_price: float64(i + 1),
+			Min_price:     float64(i),
+			Max_price:     float64(i + 2),
+			Tick_count:    int64(i + 1),
+			Price_sum:     float64((i + 1) * (i + 1)),
+		}})
+	}
+
+	points, err := db.PriceHistory("All", "DOGEUSDT", start, start.Add(time.Hour), 2*time.Minute, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Three ticks at 3 and four at 4
+	want := domain.PricePoint{Timestamp: start.Add(2 * time.Minute), Average_price: 25.0 / 7, Min_price: 2, Max_price: 5}
+	if len(points) != 1 || points[0] != want {
+		t.Errorf("points = %+v, want [%+v]", points, want)
+	}
+
+	points, err = db.PriceHistory("All", "DOGEUSDT", start, start.Add(2*time.Minute), 0, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 2 {
+		t.Errorf("got %d points, want 2", len(points))
+	}
+}
@@ -0,0 +1,92 @@
+package memory
+
+import (
+	"errors"
+	"marketflow/internal/adapters/service"
+	"marketflow/internal/domain"
+	"sync"
+)
+
+var ErrFetcherClosed = errors.New("memory fetcher is closed")
+
+// Fetcher sends exactly the ticks pushed to it through the usual batching and aggregation
+type Fetcher struct {
+	mode      string
+	flow      chan domain.Data
+	stop      chan struct{}
+	closeOnce sync.Once
+	mu        sync.Mutex
+	err       error
+}
+
+// NewFetcher returns a fetcher reporting the given mode
+func NewFetcher(mode string) *Fetcher {
+	return &Fetcher{
+		mode: mode,
+		flow: make(chan domain.Data),
+		stop: make(chan struct{}),
+	}
+}
+
+// Static check to ensure that Fetcher implements the data fetcher port
+var _ domain.DataFetcher = (*Fetcher)(nil)
+
+func (f *Fetcher) SetupDataFetcher() (chan map[string]domain.ExchangeData, chan []domain.Data, error) {
+	// Pushes never send on a closed channel, only this goroutine closes the flow
+	flow := make(chan domain.Data)
+	go func() {
+		defer close(flow)
+		for {
+			select {
+			case <-f.stop:
+				return
+			case tick := <-f.flow:
+				select {
+				case <-f.stop:
+					return
+				case flow <- tick:
+				}
+			}
+		}
+	}()
+
+	mergedCh := service.FanIn([]chan domain.Data{flow}, domain.BatchInterval)
+
+	aggregatedCh, rawCh := service.Aggregate(service.Validate(mergedCh))
+	return aggregatedCh, rawCh, nil
+}
+
+// Push hands the ticks over to the pipeline, in order, and fails once the fetcher is closed
+func (f *Fetcher) Push(ticks ...domain.Data) error {
+	for _, tick := range ticks {
+		select {
+		case <-f.stop:
+			return ErrFetcherClosed
+		case f.flow <- tick:
+		}
+	}
+	return nil
+}
+
+// Fail makes CheckHealth return err, a nil err makes the fetcher healthy again
+func (f *Fetcher) Fail(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+func (f *Fetcher) CheckHealth() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+func (f *Fetcher) Mode() string {
+	return f.mode
+}
+
+func (f *Fetcher) Close() {
+	f.closeOnce.Do(func() {
+		close(f.stop)
+	})
+}
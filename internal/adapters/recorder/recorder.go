@@ -0,0 +1,252 @@
+package recorder
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"marketflow/internal/domain"
+	"marketflow/pkg/logger"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Number of lines buffered before new lines are dropped
+const lineQueue = 4096
+
+// Line is one exchange line as it was received, the format of recorded files
+type Line struct {
+	Exchange string `json:"exchange"`
+	Received int64  `json:"received"` // ms since epoch
+	Line     string `json:"line"`
+}
+
+// Status describes the recorder for the admin API
+type Status struct {
+	Enabled bool   `json:"enabled"`
+	Dir     string `json:"dir"`
+	File    string `json:"file,omitempty"`
+	Written int64  `json:"written_bytes"`
+	Lines   int64  `json:"lines"`
+	Dropped int64  `json:"dropped"`
+}
+
+// Recorder writes the lines received from the exchanges into gzip compressed JSONL files.
+// Files are rotated once they hold maxSize uncompressed bytes or are older than maxAge.
+type Recorder struct {
+	dir     string
+	maxSize int64
+	maxAge  time.Duration
+
+	enabled atomic.Bool
+	queueMu sync.RWMutex // held by RecordLine while queueing, so no line is queued after Stop disabled recording
+	lines   chan Line
+	dropped atomic.Int64
+	count   atomic.Int64
+
+	mu      sync.Mutex // guards Start and Stop
+	stop    chan struct{}
+	done    chan struct{}
+	file    *os.File
+	gz      *gzip.Writer
+	path    atomic.Value
+	written atomic.Int64
+	opened  time.Time
+	seq     int
+}
+
+// Static check to ensure that Recorder implements LineRecorder interface
+var _ domain.LineRecorder = (*Recorder)(nil)
+
+func New(dir string, maxSize int64, maxAge time.Duration) *Recorder {
+	r := &Recorder{
+		dir:     dir,
+		maxSize: maxSize,
+		maxAge:  maxAge,
+		lines:   make(chan Line, lineQueue),
+	}
+	r.path.Store("")
+	return r
+}
+
+// RecordLine queues the line if recording is enabled. It never blocks, lines are dropped when the queue is full.
+func (r *Recorder) RecordLine(exchange, line string, received time.Time) {
+	if r == nil {
+		return
+	}
+
+	r.queueMu.RLock()
+	defer r.queueMu.RUnlock()
+	if !r.enabled.Load() {
+		return
+	}
+
+	select {
+	case r.lines <- Line{Exchange: exchange, Received: received.UnixMilli(), Line: line}:
+	default:
+		r.dropped.Add(1)
+	}
+}
+
+// Start opens a new file and starts recording
+func (r *Recorder) Start() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.enabled.Load() {
+		return domain.ErrRecordingStarted
+	}
+
+	if err := os.MkdirAll(r.dir, 0o755); err != nil {
+		return err
+	}
+
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+	go r.run(r.stop, r.done)
+
+	r.enabled.Store(true)
+	logger.Info("Recording started", "dir", r.dir)
+	return nil
+}
+
+// Stop writes the queued lines and closes the current file
+func (r *Recorder) Stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.enabled.Load() {
+		return domain.ErrRecordingStopped
+	}
+
+	// Lines queued before this belong to the current file and are written by run before it returns
+	r.queueMu.Lock()
+	r.enabled.Store(false)
+	r.queueMu.Unlock()
+	close(r.stop)
+	<-r.done
+
+	logger.Info("Recording stopped", "lines", r.count.Load(), "dropped", r.dropped.Load())
+	return r.closeFile()
+}
+
+func (r *Recorder) Status() Status {
+	return Status{
+		Enabled: r.enabled.Load(),
+		Dir:     r.dir,
+		File:    r.path.Load().(string),
+		Written: r.written.Load(),
+		Lines:   r.count.Load(),
+		Dropped: r.dropped.Load(),
+	}
+}
+
+func (r *Recorder) run(stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case line := <-r.lines:
+			r.write(line)
+		case <-ticker.C:
+			// A failed rotation is retried, an empty file is kept until it gets lines
+			if r.file == nil || (time.Since(r.opened) >= r.maxAge && r.written.Load() > 0) {
+				r.rotate()
+			}
+		case <-stop:
+			// Lines queued before the stop still belong to this recording
+			for {
+				select {
+				case line := <-r.lines:
+					r.write(line)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (r *Recorder) write(line Line) {
+	if r.gz == nil {
+		r.dropped.Add(1)
+		return
+	}
+
+	payload, err := json.Marshal(line)
+	if err != nil {
+		logger.Error("Failed to marshal recorded line", "error", err.Error())
+		return
+	}
+	payload = append(payload, '\n')
+
+	n, err := r.gz.Write(payload)
+	if err != nil {
+		logger.Error("Failed to write recorded line", "file", r.path.Load(), "error", err.Error())
+		return
+	}
+	r.count.Add(1)
+
+	if r.written.Add(int64(n)) >= r.maxSize {
+		r.rotate()
+	}
+}
+
+func (r *Recorder) rotate() {
+	if err := r.closeFile(); err != nil {
+		logger.Error("Failed to close recording file", "error", err.Error())
+	}
+
+	if err := r.open(); err != nil {
+		// Nothing is written until the next successful rotation
+		logger.Error("Failed to open recording file", "error", err.Error())
+	}
+}
+
+func (r *Recorder) open() error {
+	r.seq++
+	now := time.Now().UTC()
+	path := filepath.Join(r.dir, fmt.Sprintf("record-%s-%d.jsonl.gz", now.Format("20060102T150405"), r.seq))
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	r.file = file
+	r.gz = gzip.NewWriter(file)
+	r.opened = now
+	r.written.Store(0)
+	r.path.Store(path)
+	return nil
+}
+
+func (r *Recorder) closeFile() error {
+	if r.file == nil {
+		return nil
+	}
+
+	gzErr := r.gz.Close()
+	fileErr := r.file.Close()
+	r.file, r.gz = nil, nil
+
+	// Files without a single line are not worth keeping
+	if r.written.Load() == 0 {
+		os.Remove(r.path.Load().(string))
+		r.path.Store("")
+	}
+
+	if gzErr != nil {
+		return gzErr
+	}
+	return fileErr
+}
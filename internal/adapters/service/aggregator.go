@@ -2,45 +2,68 @@ package service
 
 import (
 	"marketflow/internal/domain"
+	"marketflow/pkg/metrics"
 	"math"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
+// Aggregate sums every batch up by exchange and symbol, separately for every window the exchange timestamps
+// of its ticks fall into. Each aggregate is stamped with the event time of its latest tick, open and close
+// prices follow the event time as well, so ticks arriving out of order do not reorder the window.
 func Aggregate(mergedCh chan []domain.Data) (chan map[string]domain.ExchangeData, chan []domain.Data) {
 	aggregatedCh := make(chan map[string]domain.ExchangeData)
 	rawDataCh := make(chan []domain.Data)
 
 	go func() {
+		// Raw batches still being sent when the input is closed
+		pending := &sync.WaitGroup{}
+
 		for dataBatch := range mergedCh {
 
 			// To prevent the main thread from being delayed
+			pending.Add(1)
 			go func() {
+				defer pending.Done()
 				rawDataCh <- dataBatch
 			}()
 
-			exchangesData := make(map[string]domain.ExchangeData)
-			counts := make(map[string]int)
-			sums := make(map[string]float64)
+			now := time.Now()
+			windows := make(map[time.Time]map[string]domain.ExchangeData)
+			opened := make(map[time.Time]map[string]time.Time)
+			sums := make(map[time.Time]map[string]float64)
 
 			for _, data := range dataBatch {
+				metrics.TicksReceived.WithLabelValues(data.ExchangeName, data.Symbol).Inc()
+
+				at := eventTime(data, now)
+				window := at.Truncate(domain.AggregationWindow)
+				if _, ok := windows[window]; !ok {
+					windows[window] = make(map[string]domain.ExchangeData)
+					opened[window] = make(map[string]time.Time)
+					sums[window] = make(map[string]float64)
+				}
+
 				keys := []string{
 					data.ExchangeName + " " + data.Symbol, // by exchange
 					"All " + data.Symbol,                  // by all exchanges
 				}
 
 				for _, key := range keys {
-					val, exists := exchangesData[key]
+					val, exists := windows[window][key]
 					if !exists {
 						val = domain.ExchangeData{
-							Exchange:  strings.Split(key, " ")[0],
-							Pair_name: data.Symbol,
-							Min_price: math.Inf(1),
-							Max_price: math.Inf(-1),
+							Exchange:   strings.Split(key, " ")[0],
+							Pair_name:  data.Symbol,
+							Min_price:  math.Inf(1),
+							Max_price:  math.Inf(-1),
+							Open_price: data.Price,
 						}
+						opened[window][key] = at
 					}
 
-					// обновление мин/макс
 					if data.Price < val.Min_price {
 						val.Min_price = data.Price
 					}
@@ -48,26 +71,57 @@ func Aggregate(mergedCh chan []domain.Data) (chan map[string]domain.ExchangeData
 						val.Max_price = data.Price
 					}
 
-					sums[key] += data.Price
-					counts[key]++
+					// Ticks with the same timestamp keep their arrival order
+					if at.Before(opened[window][key]) {
+						val.Open_price = data.Price
+						opened[window][key] = at
+					}
+					if !at.Before(val.Timestamp) {
+						val.Close_price = data.Price
+						val.Timestamp = at
+					}
+					val.Tick_count++
 
-					exchangesData[key] = val
+					sums[window][key] += data.Price
+					windows[window][key] = val
 				}
 			}
 
-			// Counting avg price
-			for key, ed := range exchangesData {
-				if count, ok := counts[key]; ok && count > 0 {
-					ed.Average_price = sums[key] / float64(count)
-					ed.Timestamp = time.Now()
+			// Older windows first, so the buffer stays ordered by event time as far as possible
+			starts := make([]time.Time, 0, len(windows))
+			for window := range windows {
+				starts = append(starts, window)
+			}
+			sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+
+			for _, window := range starts {
+				exchangesData := windows[window]
+				for key, ed := range exchangesData {
+					ed.Price_sum = sums[window][key]
+					ed.Average_price = ed.Price_sum / float64(ed.Tick_count)
 					exchangesData[key] = ed
 				}
+				aggregatedCh <- exchangesData
 			}
-			aggregatedCh <- exchangesData
 		}
 		close(aggregatedCh)
+		pending.Wait()
 		close(rawDataCh)
 	}()
 
 	return aggregatedCh, rawDataCh
 }
+
+// eventTime is the exchange timestamp of the tick. Ticks without one take the time they are aggregated at,
+// and a timestamp ahead of it is capped, so an exchange clock running ahead can not hold prices in future windows.
+func eventTime(data domain.Data, now time.Time) time.Time {
+	if data.Timestamp <= 0 {
+		return now
+	}
+
+	at := time.UnixMilli(data.Timestamp)
+	if at.After(now) {
+		return now
+	}
+	return at
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"marketflow/internal/domain"
+	"testing"
+	"time"
+)
+
+func TestAggregateByEventTime(t *testing.T) {
+	aggregationWindow := domain.AggregationWindow
+	t.Cleanup(func() { domain.AggregationWindow = aggregationWindow })
+	domain.AggregationWindow = time.Minute
+	window := time.Now().Truncate(time.Minute).Add(-time.Minute)
+	at := func(offset time.Duration, price float64) domain.Data {
+		return domain.Data{ExchangeName: "Exchange1", Symbol: domain.BTCUSDT, Price: price, Timestamp: window.Add(offset).UnixMilli()}
+	}
+
+	in := make(chan []domain.Data, 1)
+	in <- []domain.Data{
+		at(30*time.Second, 102),
+		// Out of order, it still opens the window
+		at(10*time.Second, 100),
+		at(50*time.Second, 104),
+		at(20*time.Second, 101),
+		// The next window
+		at(70*time.Second, 200),
+	}
+	close(in)
+
+	aggregatedCh, rawCh := Aggregate(in)
+	go func() {
+		for range rawCh {
+		}
+	}()
+
+	var got []domain.ExchangeData
+	for aggregated := range aggregatedCh {
+		got = append(got, aggregated["Exchange1 BTCUSDT"])
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("aggregates = %+v, want one per window", got)
+	}
+	first := got[0]
+	if first.Open_price != 100 || first.Close_price != 104 || first.Tick_count != 4 || first.Min_price != 100 || first.Max_price != 104 {
+		t.Errorf("first window = %+v, want open 100, close 104, 4 ticks", first)
+	}
+	if !first.Timestamp.Equal(window.Add(50 * time.Second)) {
+		t.Errorf("first window timestamp = %v, want the latest event time %v", first.Timestamp, window.Add(50*time.Second))
+	}
+	if second := got[1]; second.Tick_count != 1 || !second.Timestamp.Equal(window.Add(70*time.Second)) {
+		t.Errorf("second window = %+v, want the tick at %v", second, window.Add(70*time.Second))
+	}
+}
+
+func TestEventTime(t *testing.T) {
+	now := time.UnixMilli(1_700_000_000_000)
+
+	tests := []struct {
+		name      string
+		timestamp int64
+		want      time.Time
+	}{
+		{"exchange time", now.Add(-time.Second).UnixMilli(), now.Add(-time.Second)},
+		{"missing", 0, now},
+		{"ahead of the receive time", now.Add(time.Hour).UnixMilli(), now},
+	}
+	for _, tt := range tests {
+		if got := eventTime(domain.Data{Timestamp: tt.timestamp}, now); !got.Equal(tt.want) {
+			t.Errorf("%s: event time = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
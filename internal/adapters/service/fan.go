@@ -3,62 +3,34 @@ package service
 import (
 	"marketflow/internal/domain"
 	"marketflow/pkg/logger"
+	"marketflow/pkg/metrics"
 	"sync"
 	"time"
 )
 
-func FanIn(dataFlows [3]chan domain.Data) chan []domain.Data {
-	mergedCh := make(chan domain.Data, 15)
-	ch := make(chan []domain.Data, 3)
+// FanIn merges any number of exchange flows into one channel of batches, emitted every interval.
+// A closed flow is simply dropped, the rest keep being merged until all of them are closed.
+func FanIn(dataFlows []chan domain.Data, interval time.Duration) chan []domain.Data {
+	mergedCh := make(chan domain.Data, 5*len(dataFlows))
+	ch := make(chan []domain.Data, len(dataFlows))
 
-	closedCount := 0
-	var muClosed sync.Mutex
-
-	go func() {
-		defer close(mergedCh)
-
-	mainLoop:
-		for {
-			select {
-			case e1, ok := <-dataFlows[0]:
-				if !ok {
-					muClosed.Lock()
-					closedCount++
-					muClosed.Unlock()
-					dataFlows[0] = nil
-				} else {
-					mergedCh <- e1
-				}
-			case e2, ok := <-dataFlows[1]:
-				if !ok {
-					muClosed.Lock()
-					closedCount++
-					muClosed.Unlock()
-					dataFlows[1] = nil
-				} else {
-					mergedCh <- e2
-				}
-			case e3, ok := <-dataFlows[2]:
-				if !ok {
-					muClosed.Lock()
-					closedCount++
-					muClosed.Unlock()
-					dataFlows[2] = nil
-				} else {
-					mergedCh <- e3
-				}
+	flowsWg := &sync.WaitGroup{}
+	for _, flow := range dataFlows {
+		flowsWg.Add(1)
+		go func(flow chan domain.Data) {
+			defer flowsWg.Done()
+			for data := range flow {
+				mergedCh <- data
 			}
+		}(flow)
+	}
 
-			muClosed.Lock()
-			if closedCount == 3 {
-				muClosed.Unlock()
-				break mainLoop
-			}
-			muClosed.Unlock()
-		}
+	go func() {
+		flowsWg.Wait()
+		close(mergedCh)
 	}()
 
-	t := time.NewTicker(time.Second)
+	t := time.NewTicker(interval)
 	rawData := make([]domain.Data, 0)
 	done := make(chan bool)
 	mu := sync.Mutex{}
@@ -77,6 +49,7 @@ func FanIn(dataFlows [3]chan domain.Data) chan []domain.Data {
 					mu.Unlock()
 					continue
 				}
+				metrics.BatchSize.Observe(float64(len(rawData)))
 				ch <- rawData
 				rawData = make([]domain.Data, 0)
 
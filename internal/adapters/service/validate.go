@@ -0,0 +1,186 @@
+package service
+
+import (
+	"marketflow/internal/domain"
+	"marketflow/pkg/logger"
+	"marketflow/pkg/metrics"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	quarantine   domain.TickQuarantine
+	quarantineMu sync.RWMutex
+
+	tickRecorder   domain.TickRecorder
+	tickRecorderMu sync.RWMutex
+)
+
+// SetQuarantine makes Validate hand rejected ticks to q, nil only counts them
+func SetQuarantine(q domain.TickQuarantine) {
+	quarantineMu.Lock()
+	defer quarantineMu.Unlock()
+	quarantine = q
+}
+
+// SetTickRecorder makes Validate hand every received tick to r before validating it, nil records none
+func SetTickRecorder(r domain.TickRecorder) {
+	tickRecorderMu.Lock()
+	defer tickRecorderMu.Unlock()
+	tickRecorder = r
+}
+
+// Validate drops the ticks no price should be built from: not finite or non-positive prices, unknown symbols
+// and prices deviating more than domain.TickMaxDeviation percent from the median of the other exchanges,
+// unless the other exchanges moved to the same price. Rejected ticks are counted and handed to the quarantine,
+// the tick recorder gets all of them, so a replay of the recorded ticks validates them again.
+func Validate(mergedCh chan []domain.Data) chan []domain.Data {
+	validCh := make(chan []domain.Data)
+	filter := newTickFilter(domain.TickMaxDeviation/100, domain.TickMedianWindow)
+
+	go func() {
+		defer close(validCh)
+
+		for batch := range mergedCh {
+			tickRecorderMu.RLock()
+			if tickRecorder != nil {
+				tickRecorder.Record(batch)
+			}
+			tickRecorderMu.RUnlock()
+
+			now := time.Now()
+			valid := make([]domain.Data, 0, len(batch))
+			rejected := make([]domain.RejectedTick, 0)
+
+			for _, data := range batch {
+				reason, median := filter.check(data, now)
+				if reason == "" {
+					valid = append(valid, data)
+					continue
+				}
+
+				metrics.TicksRejected.WithLabelValues(data.ExchangeName, reason).Inc()
+				logger.Debug("Rejected tick", "exchange", data.ExchangeName, "symbol", data.Symbol, "price", data.Price, "reason", reason, "median", median)
+				rejected = append(rejected, domain.RejectedTick{Data: data, Reason: reason, Median: median, Received: now})
+			}
+
+			if len(rejected) != 0 {
+				quarantineMu.RLock()
+				if quarantine != nil {
+					quarantine.Quarantine(rejected)
+				}
+				quarantineMu.RUnlock()
+			}
+
+			if len(valid) != 0 {
+				validCh <- valid
+			}
+		}
+	}()
+
+	return validCh
+}
+
+type sample struct {
+	price float64
+	at    time.Time
+}
+
+// Latest prices by symbol and exchange, only used by the Validate goroutine
+type tickFilter struct {
+	maxDeviation float64 // fraction, zero disables the check
+	window       time.Duration
+	accepted     map[string]map[string]sample
+	seen         map[string]map[string]sample // rejected prices included
+}
+
+func newTickFilter(maxDeviation float64, window time.Duration) *tickFilter {
+	return &tickFilter{
+		maxDeviation: maxDeviation,
+		window:       window,
+		accepted:     make(map[string]map[string]sample),
+		seen:         make(map[string]map[string]sample),
+	}
+}
+
+// Returns the reason the tick is rejected for, empty if it is accepted, and the median it was compared to
+func (f *tickFilter) check(data domain.Data, now time.Time) (string, float64) {
+	switch {
+	case math.IsNaN(data.Price) || math.IsInf(data.Price, 0):
+		return domain.RejectNotFinite, 0
+	case data.Price <= 0:
+		return domain.RejectNonPositive, 0
+	case !knownSymbol(data.Symbol):
+		return domain.RejectUnknownSymbol, 0
+	}
+
+	if f.maxDeviation > 0 {
+		median, ok := f.median(data.Symbol, data.ExchangeName, now)
+		if ok && f.deviates(data.Price, median) && !f.confirmed(data, now) {
+			remember(f.seen, data, now)
+			return domain.RejectDeviation, median
+		}
+	}
+
+	remember(f.accepted, data, now)
+	remember(f.seen, data, now)
+	return "", 0
+}
+
+// Median of the latest accepted price of each other exchange. A deviation is only judged against
+// at least two other exchanges, so a single exchange can not get the others rejected.
+func (f *tickFilter) median(symbol, exchange string, now time.Time) (float64, bool) {
+	prices := make([]float64, 0)
+	for other, s := range f.accepted[symbol] {
+		if other != exchange && now.Sub(s.at) <= f.window {
+			prices = append(prices, s.price)
+		}
+	}
+
+	if len(prices) < 2 {
+		return 0, false
+	}
+
+	sort.Float64s(prices)
+	mid := len(prices) / 2
+	if len(prices)%2 == 0 {
+		return (prices[mid-1] + prices[mid]) / 2, true
+	}
+	return prices[mid], true
+}
+
+// A deviating price is a market move rather than a bad tick when the latest prices of at least two
+// other exchanges, rejected ones included, agree with it
+func (f *tickFilter) confirmed(data domain.Data, now time.Time) bool {
+	agree := 0
+	for other, s := range f.seen[data.Symbol] {
+		if other != data.ExchangeName && now.Sub(s.at) <= f.window && !f.deviates(data.Price, s.price) {
+			agree++
+		}
+	}
+	return agree >= 2
+}
+
+func (f *tickFilter) deviates(price, reference float64) bool {
+	return math.Abs(price-reference)/reference > f.maxDeviation
+}
+
+func remember(latest map[string]map[string]sample, data domain.Data, now time.Time) {
+	bySymbol, ok := latest[data.Symbol]
+	if !ok {
+		bySymbol = make(map[string]sample)
+		latest[data.Symbol] = bySymbol
+	}
+	bySymbol[data.ExchangeName] = sample{price: data.Price, at: now}
+}
+
+func knownSymbol(symbol string) bool {
+	for _, s := range domain.Symbols {
+		if s == symbol {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"marketflow/internal/domain"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+func tick(exchange string, price float64) domain.Data {
+	return domain.Data{ExchangeName: exchange, Symbol: domain.BTCUSDT, Price: price}
+}
+
+func TestTickFilter(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	f := newTickFilter(0.1, 30*time.Second)
+
+	tests := []struct {
+		name   string
+		data   domain.Data
+		at     time.Time
+		reason string
+	}{
+		{"zero", tick("Exchange1", 0), now, domain.RejectNonPositive},
+		{"negative", tick("Exchange1", -1), now, domain.RejectNonPositive},
+		{"nan", tick("Exchange1", math.NaN()), now, domain.RejectNotFinite},
+		{"inf", tick("Exchange1", math.Inf(1)), now, domain.RejectNotFinite},
+		{"unknown symbol", domain.Data{ExchangeName: "Exchange1", Symbol: "XRPUSDT", Price: 1}, now, domain.RejectUnknownSymbol},
+		// Nothing to compare with yet
+		{"first exchange", tick("Exchange1", 100), now, ""},
+		{"one other exchange", tick("Exchange2", 150), now, ""},
+		{"outlier", tick("Exchange3", 200), now, domain.RejectDeviation},
+		{"within deviation", tick("Exchange3", 130), now, ""},
+		// Median of 150 and 130, with the outlier it would be 175
+		{"rejected prices are not kept", tick("Exchange1", 128), now, ""},
+		{"other exchanges out of window", tick("Exchange1", 1000), now.Add(time.Minute), ""},
+	}
+	for _, tt := range tests {
+		if reason, _ := f.check(tt.data, tt.at); reason != tt.reason {
+			t.Errorf("%s: reason = %q, want %q", tt.name, reason, tt.reason)
+		}
+	}
+}
+
+func TestTickFilterMarketMove(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	f := newTickFilter(0.1, 30*time.Second)
+
+	steps := []struct {
+		data   domain.Data
+		reason string
+	}{
+		{tick("Exchange1", 100), ""},
+		{tick("Exchange2", 100), ""},
+		{tick("Exchange3", 100), ""},
+		// All three exchanges move 20%, the first two alone look like outliers
+		{tick("Exchange1", 120), domain.RejectDeviation},
+		{tick("Exchange2", 120), domain.RejectDeviation},
+		// Confirmed by the other two
+		{tick("Exchange3", 120), ""},
+		{tick("Exchange1", 121), ""},
+		{tick("Exchange2", 119), ""},
+		// A single exchange moving alone stays rejected
+		{tick("Exchange3", 150), domain.RejectDeviation},
+		{tick("Exchange3", 151), domain.RejectDeviation},
+		{tick("Exchange1", 120), ""},
+	}
+	for i, step := range steps {
+		at := now.Add(time.Duration(i) * time.Second)
+		if reason, _ := f.check(step.data, at); reason != step.reason {
+			t.Errorf("step %d %s %v: reason = %q, want %q", i, step.data.ExchangeName, step.data.Price, reason, step.reason)
+		}
+	}
+}
+
+func TestTickFilterDisabled(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	f := newTickFilter(0, 30*time.Second)
+
+	for _, data := range []domain.Data{tick("Exchange1", 100), tick("Exchange2", 100), tick("Exchange3", 1000)} {
+		if reason, _ := f.check(data, now); reason != "" {
+			t.Errorf("%s %v: reason = %q, want none", data.ExchangeName, data.Price, reason)
+		}
+	}
+}
+
+type quarantineStub struct {
+	mu    sync.Mutex
+	ticks []domain.RejectedTick
+}
+
+func (q *quarantineStub) Quarantine(ticks []domain.RejectedTick) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.ticks = append(q.ticks, ticks...)
+}
+
+func (q *quarantineStub) Close() {}
+
+type recorderStub struct {
+	mu    sync.Mutex
+	ticks []domain.Data
+}
+
+func (r *recorderStub) Record(ticks []domain.Data) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ticks = append(r.ticks, ticks...)
+}
+
+func (r *recorderStub) Close() {}
+
+func TestValidate(t *testing.T) {
+	q := &quarantineStub{}
+	SetQuarantine(q)
+	defer SetQuarantine(nil)
+	r := &recorderStub{}
+	SetTickRecorder(r)
+	defer SetTickRecorder(nil)
+
+	in := make(chan []domain.Data)
+	out := Validate(in)
+	go func() {
+		in <- []domain.Data{tick("Exchange1", 100), tick("Exchange2", -5), tick("Exchange2", 101)}
+		// A batch without valid ticks is not forwarded
+		in <- []domain.Data{tick("Exchange3", math.NaN())}
+		close(in)
+	}()
+
+	var batches [][]domain.Data
+	for batch := range out {
+		batches = append(batches, batch)
+	}
+
+	if len(batches) != 1 || len(batches[0]) != 2 || batches[0][0].Price != 100 || batches[0][1].Price != 101 {
+		t.Errorf("valid batches = %v, want one batch with prices 100 and 101", batches)
+	}
+	if len(q.ticks) != 2 || q.ticks[0].Reason != domain.RejectNonPositive || q.ticks[1].Reason != domain.RejectNotFinite {
+		t.Errorf("quarantined = %+v, want a non positive and a not finite tick", q.ticks)
+	}
+	// Rejected ticks are recorded as well
+	if len(r.ticks) != 4 {
+		t.Errorf("recorded %+v, want all 4 ticks", r.ticks)
+	}
+}
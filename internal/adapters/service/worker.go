@@ -4,20 +4,63 @@ import (
 	"encoding/json"
 	"marketflow/internal/domain"
 	"marketflow/pkg/logger"
+	"marketflow/pkg/metrics"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// Worker processes tasks from the jobs channel and sends the results to the results channel
-func Worker(number string, jobs chan string, results chan domain.Data, wg *sync.WaitGroup) {
+// Weight of a new sample in the smoothed clock skew
+const skewSmoothing = 0.1
+
+// WorkerStats are shared by the workers of one exchange
+type WorkerStats struct {
+	ParseErrors atomic.Int64
+	mu          sync.Mutex
+	skew        time.Duration // smoothed receive time minus exchange timestamp, guarded by mu
+	skewSet     bool
+}
+
+// ClockSkew returns how far the exchange timestamps lag behind the receive time, network delay included.
+// A negative skew means the exchange clock runs ahead. It is false until a timestamped tick was received.
+func (s *WorkerStats) ClockSkew() (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.skew, s.skewSet
+}
+
+func (s *WorkerStats) observeSkew(sample time.Duration) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.skewSet {
+		s.skew, s.skewSet = sample, true
+	} else {
+		s.skew += time.Duration(skewSmoothing * float64(sample-s.skew))
+	}
+	return s.skew
+}
+
+// Worker processes tasks from the jobs channel and sends the results to the results channel.
+// Parse errors and the clock skew of the exchange are tracked in stats, if it is not nil.
+func Worker(number string, jobs chan string, results chan domain.Data, stats *WorkerStats, wg *sync.WaitGroup) {
 	defer wg.Done()
 	for j := range jobs {
 		data := domain.Data{}
 		err := json.Unmarshal([]byte(j), &data)
 		if err != nil {
-			logger.Error("Unmarshalling error in worker", err.Error())
+			logger.Error("Unmarshalling error in worker", "Exchange name", number, "error", err.Error())
+			metrics.UnmarshalErrors.WithLabelValues(number).Inc()
+			if stats != nil {
+				stats.ParseErrors.Add(1)
+			}
 			continue
 		}
 
+		if stats != nil && data.Timestamp > 0 {
+			skew := stats.observeSkew(time.Since(time.UnixMilli(data.Timestamp)))
+			metrics.ClockSkew.WithLabelValues(number).Set(skew.Seconds())
+		}
+
 		// Assigning the name of the exchange and send it to the results channel
 		data.ExchangeName = number
 		results <- data
@@ -0,0 +1,513 @@
+// Package spool keeps the aggregates the database could not take on disk until they are written
+package spool
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"marketflow/internal/domain"
+	"marketflow/pkg/logger"
+	"marketflow/pkg/metrics"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	segmentPrefix = "segment-"
+	segmentSuffix = ".log"
+	cursorFile    = "cursor"
+)
+
+// Saver writes the aggregates of a spool record into the database. The batch id must be stored in the
+// same transaction as the rows and a batch saved before skipped, records are replayed after a crash
+// between their save and the cursor update. Records spooled by older versions have no id.
+type Saver func(batch string, aggregatedData map[string]domain.ExchangeData) error
+
+// One spooled flush, a line of a segment file
+type record struct {
+	ID   string                         `json:"id,omitempty"`
+	Rows map[string]domain.ExchangeData `json:"rows"`
+}
+
+// Position of the next record to write into the database
+type cursor struct {
+	Segment uint64 `json:"segment"`
+	Offset  int64  `json:"offset"`
+}
+
+// Spool is an append-only log of segment files holding aggregates the database could not take. Records are
+// written into the database in the order they were appended, retried with exponential backoff while it fails.
+// The position of the next record is kept in a cursor file, so a restart resumes where the spool stopped.
+type Spool struct {
+	dir         string
+	segmentSize int64
+	save        Saver
+	retry       time.Duration
+	maxRetry    time.Duration
+
+	writeMu    sync.Mutex // serializes Write, so a write can not slip between the check and the save of another
+	mu         sync.Mutex
+	segments   []uint64 // sequence numbers of the segment files, oldest first
+	active     *os.File // segment appended to, nil until the first append
+	activeSize int64
+	inflight   *record // record of the Write saving into the database, taken over by Append
+	cursor     cursor
+	records    int
+	bytes      int64
+	lastErr    error
+
+	wake      chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Static check to ensure that Spool implements AggregateSpool interface
+var _ domain.AggregateSpool = (*Spool)(nil)
+
+// Open opens the spool in dir, creating it if needed, and starts writing the records left by a previous run
+func Open(dir string, segmentSize int64, save Saver, retry, maxRetry time.Duration) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	s := &Spool{
+		dir:         dir,
+		segmentSize: segmentSize,
+		save:        save,
+		retry:       retry,
+		maxRetry:    maxRetry,
+		wake:        make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	s.updateMetrics()
+	if s.records > 0 {
+		logger.Info("Spooled aggregates found, writing them into the database", "records", s.records, "bytes", s.bytes)
+		s.wake <- struct{}{}
+	}
+
+	go s.run()
+	return s, nil
+}
+
+// Reads the segment list and the cursor and counts the records after it. Appends always go to a new segment,
+// so a line torn by a crash is never continued.
+func (s *Spool) load() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read spool directory: %w", err)
+	}
+	for _, entry := range entries {
+		if seq, ok := parseSegmentName(entry.Name()); ok {
+			s.segments = append(s.segments, seq)
+		}
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i] < s.segments[j] })
+
+	raw, err := os.ReadFile(filepath.Join(s.dir, cursorFile))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("failed to read spool cursor: %w", err)
+	default:
+		if err := json.Unmarshal(raw, &s.cursor); err != nil {
+			return fmt.Errorf("invalid spool cursor: %w", err)
+		}
+	}
+
+	for _, seq := range s.segments {
+		if seq < s.cursor.Segment {
+			continue
+		}
+		offset := int64(0)
+		if seq == s.cursor.Segment {
+			offset = s.cursor.Offset
+		}
+		records, bytes, err := s.count(seq, offset)
+		if err != nil {
+			return err
+		}
+		s.records += records
+		s.bytes += bytes
+	}
+	return nil
+}
+
+// Counts the complete lines of the segment after offset
+func (s *Spool) count(seq uint64, offset int64) (int, int64, error) {
+	file, err := os.Open(s.segmentPath(seq))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open spool segment: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+
+	var records int
+	var bytes int64
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return records, bytes, nil
+		}
+		records++
+		bytes += int64(len(line))
+	}
+}
+
+// Write saves the aggregates into the database while the spool is empty and appends them to it otherwise
+// or if the save fails, so they reach the database in the order they were written. The direct save stores
+// the batch id like a replay does, so a record Append took over from a hanging save is written only once.
+func (s *Spool) Write(aggregatedData map[string]domain.ExchangeData) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	rec, err := newRecord(aggregatedData)
+	if err != nil {
+		return err
+	}
+
+	// Records only leave the spool while it is not empty, so it stays empty during the save
+	s.mu.Lock()
+	empty := s.records == 0
+	if empty {
+		s.inflight = rec
+	}
+	s.mu.Unlock()
+
+	if empty {
+		err := s.save(rec.ID, rec.Rows)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.inflight != rec {
+			// Appended by Append in the meantime
+			return nil
+		}
+		s.inflight = nil
+		if err == nil {
+			return nil
+		}
+		logger.Warn("Failed to save aggregated data to Db, spooling it", "error", err)
+		return s.appendLocked(rec)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.appendLocked(rec)
+}
+
+// Append writes the aggregates to the end of the spool and syncs them to disk. It does not wait for
+// a write saving into the database, the record of such a write is appended first to keep the order.
+func (s *Spool) Append(aggregatedData map[string]domain.ExchangeData) error {
+	rec, err := newRecord(aggregatedData)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.inflight != nil {
+		if err := s.appendLocked(s.inflight); err != nil {
+			return err
+		}
+		s.inflight = nil
+	}
+	return s.appendLocked(rec)
+}
+
+func newRecord(aggregatedData map[string]domain.ExchangeData) (*record, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	return &record{ID: hex.EncodeToString(id), Rows: aggregatedData}, nil
+}
+
+// Must be called with mu held
+func (s *Spool) appendLocked(rec *record) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	if s.active == nil || (s.activeSize > 0 && s.activeSize+int64(len(line)) > s.segmentSize) {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.active.Write(line)
+	s.activeSize += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write spool segment: %w", err)
+	}
+	if err := s.active.Sync(); err != nil {
+		return fmt.Errorf("failed to sync spool segment: %w", err)
+	}
+
+	s.records++
+	s.bytes += int64(n)
+	s.updateMetrics()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Starts a new segment, must be called with mu held
+func (s *Spool) rotate() error {
+	if s.active != nil {
+		if err := s.active.Close(); err != nil {
+			logger.Error("Failed to close spool segment", "error", err)
+		}
+	}
+
+	seq := s.cursor.Segment
+	if n := len(s.segments); n > 0 {
+		seq = max(seq, s.segments[n-1]+1)
+	}
+
+	file, err := os.OpenFile(s.segmentPath(seq), os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		s.active = nil
+		return fmt.Errorf("failed to create spool segment: %w", err)
+	}
+
+	s.segments = append(s.segments, seq)
+	s.active = file
+	s.activeSize = 0
+	return nil
+}
+
+// Health returns the depth of the spool and the last error writing it into the database
+func (s *Spool) Health() domain.SpoolHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	health := domain.SpoolHealth{
+		Records:  s.records,
+		Bytes:    s.bytes,
+		Segments: len(s.segments),
+	}
+	if s.lastErr != nil {
+		health.LastError = s.lastErr.Error()
+	}
+	return health
+}
+
+// Close stops writing into the database, the remaining records are written after the next start
+func (s *Spool) Close() {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		<-s.done
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.active != nil {
+			s.active.Close()
+			s.active = nil
+		}
+	})
+}
+
+func (s *Spool) run() {
+	defer close(s.done)
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-s.wake:
+		}
+
+		delay := s.retry
+		for {
+			err := s.drain()
+			s.mu.Lock()
+			s.lastErr = err
+			s.mu.Unlock()
+			if err == nil {
+				break
+			}
+
+			logger.Warn("Failed to write spooled aggregates, retrying", "retry_in", delay.String(), "error", err)
+			select {
+			case <-s.stop:
+				return
+			case <-time.After(delay):
+			}
+			delay = min(2*delay, s.maxRetry)
+		}
+	}
+}
+
+// Writes the records after the cursor into the database until the spool is empty or a write fails
+func (s *Spool) drain() error {
+	for {
+		select {
+		case <-s.stop:
+			return nil
+		default:
+		}
+
+		rec, size, ok, err := s.next()
+		if err != nil || !ok {
+			return err
+		}
+
+		if rec != nil {
+			if err := s.save(rec.ID, rec.Rows); err != nil {
+				return err
+			}
+			metrics.SpoolReplayed.Inc()
+		}
+
+		if err := s.advance(size); err != nil {
+			return err
+		}
+	}
+}
+
+// Reads the record at the cursor. Fully read segments before the active one are removed on the way.
+// A record that can not be decoded is skipped, the record is nil then.
+func (s *Spool) next() (*record, int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.segments) > 0 {
+		if s.segments[0] < s.cursor.Segment {
+			s.removeOldest()
+			continue
+		}
+		if s.segments[0] > s.cursor.Segment {
+			s.cursor = cursor{Segment: s.segments[0]}
+		}
+
+		line, err := s.readLine(s.cursor)
+		if err != nil {
+			return nil, 0, false, err
+		}
+		if line != nil {
+			var rec record
+			if err := json.Unmarshal(line, &rec); err != nil {
+				logger.Error("Skipping corrupt spool record", "segment", s.cursor.Segment, "offset", s.cursor.Offset, "error", err)
+				return nil, int64(len(line)), true, nil
+			}
+			return &rec, int64(len(line)), true, nil
+		}
+
+		// The active segment is still appended to, older ones are done
+		if len(s.segments) == 1 && s.active != nil {
+			return nil, 0, false, nil
+		}
+		done := s.segments[0]
+		s.removeOldest()
+		// Segment numbers are never reused, so the cursor can not point into an old segment
+		s.cursor = cursor{Segment: done + 1}
+		if len(s.segments) > 0 {
+			s.cursor.Segment = s.segments[0]
+		}
+		if err := s.saveCursor(); err != nil {
+			return nil, 0, false, err
+		}
+	}
+	return nil, 0, false, nil
+}
+
+// Reads the complete line at the position, nil at the end of the segment
+func (s *Spool) readLine(at cursor) ([]byte, error) {
+	file, err := os.Open(s.segmentPath(at.Segment))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spool segment: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(at.Offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	line, err := bufio.NewReader(file).ReadBytes('\n')
+	if err != nil {
+		// A line without its newline is torn or still being written
+		return nil, nil
+	}
+	return line, nil
+}
+
+// Moves the cursor past the record just written, must not be called with mu held
+func (s *Spool) advance(size int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cursor.Offset += size
+	s.records--
+	s.bytes -= size
+	s.updateMetrics()
+	return s.saveCursor()
+}
+
+// Must be called with mu held
+func (s *Spool) removeOldest() {
+	seq := s.segments[0]
+	s.segments = s.segments[1:]
+	if err := os.Remove(s.segmentPath(seq)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logger.Error("Failed to remove spool segment", "segment", seq, "error", err)
+	}
+}
+
+// Writes the cursor atomically, must be called with mu held
+func (s *Spool) saveCursor() error {
+	raw, err := json.Marshal(s.cursor)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(s.dir, cursorFile+".tmp")
+	if err := os.WriteFile(tmp, raw, 0o644); err != nil {
+		return fmt.Errorf("failed to write spool cursor: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, cursorFile)); err != nil {
+		return fmt.Errorf("failed to write spool cursor: %w", err)
+	}
+	return nil
+}
+
+// Must be called with mu held
+func (s *Spool) updateMetrics() {
+	metrics.SpoolRecords.Set(float64(s.records))
+	metrics.SpoolBytes.Set(float64(s.bytes))
+}
+
+func (s *Spool) segmentPath(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s%020d%s", segmentPrefix, seq, segmentSuffix))
+}
+
+func parseSegmentName(name string) (uint64, bool) {
+	if !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix), 10, 64)
+	return seq, err == nil
+}
@@ -0,0 +1,279 @@
+package spool
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"marketflow/internal/domain"
+	"marketflow/pkg/logger"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errDown = errors.New("database is down")
+
+// Database stub failing until it is brought up, skipping batches it saved before
+type saver struct {
+	mu      sync.Mutex
+	up      bool
+	saved   []float64
+	batches map[string]bool
+	calls   int
+	hold    chan struct{} // saves wait for it to close while set
+	held    chan struct{} // signaled when a save starts waiting
+}
+
+func (s *saver) save(batch string, rows map[string]domain.ExchangeData) error {
+	s.mu.Lock()
+	hold, held := s.hold, s.held
+	s.mu.Unlock()
+	if hold != nil {
+		select {
+		case held <- struct{}{}:
+		default:
+		}
+		<-hold
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if !s.up {
+		return errDown
+	}
+	if s.batches == nil {
+		s.batches = make(map[string]bool)
+	}
+	if s.batches[batch] {
+		return nil
+	}
+	if batch != "" {
+		s.batches[batch] = true
+	}
+	s.saved = append(s.saved, rows["Exchange1 BTCUSDT"].Average_price)
+	return nil
+}
+
+func (s *saver) setUp(up bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.up = up
+}
+
+func (s *saver) prices() []float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]float64(nil), s.saved...)
+}
+
+func rows(price float64) map[string]domain.ExchangeData {
+	return map[string]domain.ExchangeData{"Exchange1 BTCUSDT": {Exchange: "Exchange1", Pair_name: domain.BTCUSDT, Average_price: price}}
+}
+
+func open(t *testing.T, dir string, s *saver) *Spool {
+	t.Helper()
+	log := logger.Log
+	t.Cleanup(func() { logger.Log = log })
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// Small segments, so the records span several of them
+	spool, err := Open(dir, 100, s.save, time.Millisecond, 5*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(spool.Close)
+	return spool
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func equal(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSpoolReplaysInOrderOnceTheDatabaseIsBack(t *testing.T) {
+	db := &saver{}
+	spool := open(t, t.TempDir(), db)
+
+	for _, price := range []float64{1, 2, 3, 4} {
+		if err := spool.Append(rows(price)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	waitFor(t, func() bool { return spool.Health().LastError == errDown.Error() })
+	if health := spool.Health(); health.Records != 4 || health.Segments < 2 {
+		t.Errorf("health = %+v, want 4 records in several segments", health)
+	}
+
+	db.setUp(true)
+	// The error is cleared once the drain is done, right after the last record
+	waitFor(t, func() bool { health := spool.Health(); return health.Records == 0 && health.LastError == "" })
+
+	if got := db.prices(); !equal(got, []float64{1, 2, 3, 4}) {
+		t.Errorf("saved %v, want [1 2 3 4]", got)
+	}
+	if health := spool.Health(); health.Bytes != 0 || health.Segments > 1 || health.LastError != "" {
+		t.Errorf("health = %+v, want an empty spool with only the active segment left", health)
+	}
+}
+
+func TestSpoolResumesAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	db := &saver{}
+
+	spool := open(t, dir, db)
+	for _, price := range []float64{1, 2, 3} {
+		if err := spool.Append(rows(price)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	spool.Close()
+
+	// A crash in the middle of an append leaves a torn line behind
+	segments, _ := filepath.Glob(filepath.Join(dir, segmentPrefix+"*"))
+	file, err := os.OpenFile(segments[len(segments)-1], os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"rows":{"Exchange1 BTC`)
+	file.Close()
+
+	db.setUp(true)
+	spool = open(t, dir, db)
+	waitFor(t, func() bool { return spool.Health().Records == 0 })
+
+	if err := spool.Append(rows(4)); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return spool.Health().Records == 0 })
+
+	if got := db.prices(); !equal(got, []float64{1, 2, 3, 4}) {
+		t.Errorf("saved %v, want [1 2 3 4]", got)
+	}
+}
+
+func TestSpoolReplayAfterCrashIsSkipped(t *testing.T) {
+	dir := t.TempDir()
+	db := &saver{up: true}
+
+	spool := open(t, dir, db)
+	if err := spool.Append(rows(1)); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return spool.Health().Records == 0 })
+	spool.Close()
+
+	// A crash after the save but before the cursor update leaves the cursor at the record
+	raw, err := os.ReadFile(filepath.Join(dir, cursorFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var at cursor
+	if err := json.Unmarshal(raw, &at); err != nil {
+		t.Fatal(err)
+	}
+	at.Offset = 0
+	raw, _ = json.Marshal(at)
+	if err := os.WriteFile(filepath.Join(dir, cursorFile), raw, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	spool = open(t, dir, db)
+	waitFor(t, func() bool { return spool.Health().Records == 0 })
+
+	db.mu.Lock()
+	calls := db.calls
+	db.mu.Unlock()
+	if got := db.prices(); calls != 2 || !equal(got, []float64{1}) {
+		t.Errorf("saved %v in %d calls, want [1] saved once and replayed once", got, calls)
+	}
+}
+
+// Makes the saves wait until the returned function is called
+func (s *saver) holdSaves() (held chan struct{}, release func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hold, s.held = make(chan struct{}), make(chan struct{}, 1)
+	hold := s.hold
+	return s.held, func() {
+		s.mu.Lock()
+		s.hold = nil
+		s.mu.Unlock()
+		close(hold)
+	}
+}
+
+func TestSpoolWrite(t *testing.T) {
+	db := &saver{up: true}
+	spool := open(t, t.TempDir(), db)
+
+	// Saved directly while the spool is empty
+	if err := spool.Write(rows(1)); err != nil {
+		t.Fatal(err)
+	}
+	if health := spool.Health(); health.Records != 0 || !equal(db.prices(), []float64{1}) {
+		t.Fatalf("health = %+v, saved %v, want [1] saved directly", health, db.prices())
+	}
+
+	// Aggregates appended while a save hangs go after the aggregates of that save, even if it fails
+	db.setUp(false)
+	held, release := db.holdSaves()
+	written := make(chan error)
+	go func() { written <- spool.Write(rows(2)) }()
+	<-held
+	if err := spool.Append(rows(3)); err != nil {
+		t.Fatal(err)
+	}
+	if health := spool.Health(); health.Records != 2 {
+		t.Errorf("health = %+v, want the hanging write spooled before the append", health)
+	}
+	release()
+	if err := <-written; err != nil {
+		t.Fatal(err)
+	}
+
+	db.setUp(true)
+	waitFor(t, func() bool { return spool.Health().Records == 0 })
+	if got := db.prices(); !equal(got, []float64{1, 2, 3}) {
+		t.Fatalf("saved %v, want [1 2 3]", got)
+	}
+
+	// A hanging save that succeeds after all is not written again by the replay
+	held, release = db.holdSaves()
+	go func() { written <- spool.Write(rows(4)) }()
+	<-held
+	if err := spool.Append(rows(5)); err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if err := <-written; err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, func() bool { return spool.Health().Records == 0 })
+	if got := db.prices(); !equal(got, []float64{1, 2, 3, 4, 5}) {
+		t.Errorf("saved %v, want [1 2 3 4 5]", got)
+	}
+}
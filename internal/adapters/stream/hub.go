@@ -0,0 +1,198 @@
+package stream
+
+import (
+	"marketflow/internal/domain"
+	"marketflow/pkg/logger"
+	"sync"
+)
+
+// Number of events buffered per client before it is considered too slow and dropped
+const clientBuffer = 256
+
+// Channels clients can subscribe to
+const (
+	ChannelPrices     = "prices"     // every raw price update
+	ChannelAggregates = "aggregates" // aggregated snapshot on each window flush
+)
+
+// Wildcard in subscription keys
+const wildcard = "*"
+
+var Channels = []string{ChannelPrices, ChannelAggregates}
+
+// Event is a single update delivered to the clients subscribed to its channel
+type Event struct {
+	Channel  string `json:"channel"`
+	Data     any    `json:"data"`
+	exchange string
+	symbol   string
+}
+
+// Hub broadcasts events to subscribed clients without ever blocking the publisher
+type Hub struct {
+	mu      sync.RWMutex
+	clients map[*Client]struct{}
+	closed  bool
+}
+
+// Client is a single connection with its own buffer and subscriptions
+type Client struct {
+	events    chan Event
+	done      chan struct{}
+	closeOnce sync.Once
+	mu        sync.RWMutex
+	subs      map[string]bool
+}
+
+func NewHub() *Hub {
+	return &Hub{clients: make(map[*Client]struct{})}
+}
+
+// Connect registers a client without any subscriptions
+func (h *Hub) Connect() *Client {
+	client := &Client{
+		events: make(chan Event, clientBuffer),
+		done:   make(chan struct{}),
+		subs:   make(map[string]bool),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		client.close()
+		return client
+	}
+
+	h.clients[client] = struct{}{}
+	return client
+}
+
+// Disconnect removes the client and closes it
+func (h *Hub) Disconnect(client *Client) {
+	h.mu.Lock()
+	delete(h.clients, client)
+	h.mu.Unlock()
+	client.close()
+}
+
+// Publish hands every price update of the batch to the subscribed clients
+func (h *Hub) Publish(batch []domain.Data) {
+	events := make([]Event, 0, len(batch))
+	for _, data := range batch {
+		events = append(events, Event{Channel: ChannelPrices, Data: data, exchange: data.ExchangeName, symbol: data.Symbol})
+	}
+	h.publish(events)
+}
+
+// PublishAggregates hands the flushed aggregates to the subscribed clients
+func (h *Hub) PublishAggregates(aggregated map[string]domain.ExchangeData) {
+	events := make([]Event, 0, len(aggregated))
+	for _, data := range aggregated {
+		events = append(events, Event{Channel: ChannelAggregates, Data: data, exchange: data.Exchange, symbol: data.Pair_name})
+	}
+	h.publish(events)
+}
+
+// Clients with a full buffer are dropped, so a slow reader never blocks ingestion
+func (h *Hub) publish(events []Event) {
+	var slow []*Client
+
+	h.mu.RLock()
+	for client := range h.clients {
+	eventLoop:
+		for _, event := range events {
+			if !client.matches(event) {
+				continue
+			}
+
+			select {
+			case client.events <- event:
+			default:
+				slow = append(slow, client)
+				break eventLoop
+			}
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, client := range slow {
+		logger.Warn("Dropping slow stream client", "buffer", clientBuffer)
+		h.Disconnect(client)
+	}
+}
+
+// Close disconnects every client, later connections are closed right away
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for client := range h.clients {
+		client.close()
+		delete(h.clients, client)
+	}
+}
+
+// Subscribe adds the channel updates of the given symbols and exchanges, an empty list matches everything.
+// "All" is an exchange like the others, it only matches the aggregates across the exchanges.
+func (c *Client) Subscribe(channel string, symbols, exchanges []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range subscriptionKeys(channel, symbols, exchanges) {
+		c.subs[key] = true
+	}
+}
+
+// Unsubscribe removes subscriptions made with the same arguments
+func (c *Client) Unsubscribe(channel string, symbols, exchanges []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range subscriptionKeys(channel, symbols, exchanges) {
+		delete(c.subs, key)
+	}
+}
+
+// Events returns the channel of events for the client
+func (c *Client) Events() <-chan Event {
+	return c.events
+}
+
+// Done is closed when the client is disconnected, dropped or the hub is closed
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *Client) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+}
+
+func (c *Client) matches(event Event) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.subs[key(event.Channel, event.exchange, event.symbol)] ||
+		c.subs[key(event.Channel, wildcard, event.symbol)] ||
+		c.subs[key(event.Channel, event.exchange, wildcard)] ||
+		c.subs[key(event.Channel, wildcard, wildcard)]
+}
+
+func subscriptionKeys(channel string, symbols, exchanges []string) []string {
+	if len(symbols) == 0 {
+		symbols = []string{wildcard}
+	}
+	if len(exchanges) == 0 {
+		exchanges = []string{wildcard}
+	}
+
+	keys := make([]string, 0, len(symbols)*len(exchanges))
+	for _, exchange := range exchanges {
+		for _, symbol := range symbols {
+			keys = append(keys, key(channel, exchange, symbol))
+		}
+	}
+	return keys
+}
+
+func key(channel, exchange, symbol string) string {
+	return channel + " " + exchange + " " + symbol
+}
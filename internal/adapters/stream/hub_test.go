@@ -0,0 +1,34 @@
+package stream
+
+import (
+	"marketflow/internal/domain"
+	"testing"
+)
+
+func TestSubscribeAllExchanges(t *testing.T) {
+	hub := NewHub()
+	defer hub.Close()
+
+	all := hub.Connect()
+	all.Subscribe(ChannelAggregates, nil, []string{"All"})
+	every := hub.Connect()
+	every.Subscribe(ChannelAggregates, []string{domain.BTCUSDT}, nil)
+
+	hub.PublishAggregates(map[string]domain.ExchangeData{
+		"Exchange1 BTCUSDT": {Exchange: "Exchange1", Pair_name: domain.BTCUSDT},
+		"All BTCUSDT":       {Exchange: "All", Pair_name: domain.BTCUSDT},
+	})
+
+	// Only the aggregate across the exchanges
+	if n := len(all.Events()); n != 1 {
+		t.Fatalf("All subscription got %d events, want 1", n)
+	}
+	if event := <-all.Events(); event.exchange != "All" {
+		t.Errorf("All subscription got %s, want the All aggregate", event.exchange)
+	}
+
+	// No exchanges given matches every exchange, All included
+	if n := len(every.Events()); n != 2 {
+		t.Errorf("subscription without exchanges got %d events, want 2", n)
+	}
+}
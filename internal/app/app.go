@@ -16,7 +16,11 @@ import (
 	"marketflow/internal/adapters/cache"
 	"marketflow/internal/adapters/db"
 	"marketflow/internal/adapters/exchange"
+	"marketflow/internal/adapters/recorder"
+	"marketflow/internal/adapters/service"
+	"marketflow/internal/adapters/spool"
 	"marketflow/internal/domain"
+	"marketflow/pkg/config"
 	"marketflow/pkg/logger"
 )
 
@@ -38,16 +42,124 @@ func Flags() {
 		fmt.Println(domain.HelpMessage)
 		os.Exit(0)
 	}
+
+	aggregatorConfig, err := config.LoadAggregatorConfig(*domain.WindowFlag, *domain.BatchFlag)
+	if err != nil {
+		logger.Error("Invalid aggregator config", "error", err)
+		os.Exit(1)
+	}
+	domain.AggregationWindow = aggregatorConfig.Window
+	domain.BatchInterval = aggregatorConfig.BatchInterval
+	domain.AllowedLateness = aggregatorConfig.AllowedLateness
+	domain.LateTicks = aggregatorConfig.LateTicks
+	domain.FlushTimeout = aggregatorConfig.FlushTimeout
 }
 
 func SetupApp() (*http.Server, func()) {
+	exchangeConfig, err := config.LoadExchangeConfig()
+	if err != nil {
+		logger.Error("Error loading exchange config", "error", err)
+		os.Exit(1)
+	}
+	domain.SetExchanges(exchangeConfig.Names)
+	domain.ReplayDir = config.LoadReplayDir()
+	domain.ScenarioDir = config.LoadScenarioDir()
+	domain.AdminToken = config.LoadAdminToken()
+	if domain.AdminToken == "" {
+		logger.Warn("ADMIN_TOKEN is not set, the admin API is open to every client")
+	}
+
+	stalenessConfig, err := config.LoadStalenessConfig(domain.Symbols)
+	if err != nil {
+		logger.Error("Invalid staleness config", "error", err)
+		os.Exit(1)
+	}
+	domain.StaleThreshold = stalenessConfig.Threshold
+	domain.StaleThresholds = stalenessConfig.Thresholds
+	domain.StaleAction = stalenessConfig.Action
+
+	tickFilterConfig, err := config.LoadTickFilterConfig()
+	if err != nil {
+		logger.Error("Invalid tick filter config", "error", err)
+		os.Exit(1)
+	}
+	domain.TickMaxDeviation = tickFilterConfig.MaxDeviation
+	domain.TickMedianWindow = tickFilterConfig.MedianWindow
+
 	repo := db.NewPostgres()
+	if *domain.MigrateFlag {
+		if err := migrateUp(repo); err != nil {
+			logger.Error("Failed to migrate the database", "error", err)
+			os.Exit(1)
+		}
+	}
 
 	cache := cache.NewRedis()
 
-	exchange := exchange.NewLiveModeFetcher()
+	recordConfig, err := config.LoadRecordConfig()
+	if err != nil {
+		logger.Error("Invalid recorder config", "error", err)
+		os.Exit(1)
+	}
+	lineRecorder := recorder.New(recordConfig.Dir, recordConfig.MaxSize, recordConfig.MaxAge)
+	if recordConfig.Enabled {
+		if err := lineRecorder.Start(); err != nil {
+			logger.Error("Failed to start recording", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	exchange := exchange.NewLiveModeFetcher(lineRecorder)
 
 	datafetch := server.NewDataFetcher(exchange, repo, cache)
+	datafetch.Recorder = lineRecorder
+
+	rawTickConfig, err := config.LoadRawTickConfig()
+	if err != nil {
+		logger.Error("Invalid raw tick store config", "error", err)
+		os.Exit(1)
+	}
+	var ticks domain.TickRecorder
+	if rawTickConfig.Enabled {
+		logger.Info("Raw tick store enabled", "batch_size", rawTickConfig.BatchSize, "flush_interval", rawTickConfig.FlushInterval.String())
+		// Recorded before validation, so the store holds the rejected ticks as well
+		ticks = repo.NewRawTickWriter(rawTickConfig.BatchSize, rawTickConfig.FlushInterval)
+		service.SetTickRecorder(ticks)
+	}
+
+	spoolConfig, err := config.LoadSpoolConfig()
+	if err != nil {
+		logger.Error("Invalid spool config", "error", err)
+		os.Exit(1)
+	}
+	var aggregateSpool *spool.Spool
+	if spoolConfig.Enabled {
+		aggregateSpool, err = spool.Open(spoolConfig.Dir, spoolConfig.SegmentSize, repo.SaveSpooledData, spoolConfig.RetryInterval, spoolConfig.MaxRetryInterval)
+		if err != nil {
+			logger.Error("Failed to open spool", "dir", spoolConfig.Dir, "error", err)
+			os.Exit(1)
+		}
+		logger.Info("Spool of aggregates enabled", "dir", spoolConfig.Dir)
+		datafetch.Spool = aggregateSpool
+	}
+
+	retentionConfig, err := config.LoadRetentionConfig(domain.AggregationWindow)
+	if err != nil {
+		logger.Error("Invalid retention config", "error", err)
+		os.Exit(1)
+	}
+	var compactor *db.Compactor
+	if retentionConfig.Enabled {
+		logger.Info("Retention of aggregates enabled", "base", retentionConfig.Base.String(), "tiers", len(retentionConfig.Tiers), "interval", retentionConfig.Interval.String())
+		compactor = repo.NewCompactor(retentionConfig)
+	}
+
+	var quarantine *db.QuarantineWriter
+	if tickFilterConfig.QuarantineEnabled {
+		logger.Info("Quarantine of rejected ticks enabled")
+		quarantine = repo.NewQuarantineWriter()
+		service.SetQuarantine(quarantine)
+	}
 
 	if err := datafetch.ListenAndSave(); err != nil {
 		logger.Error("Failed to start data fetcher", "error", err)
@@ -60,12 +172,31 @@ func SetupApp() (*http.Server, func()) {
 		Addr:    ":" + *domain.Port,
 		Handler: router,
 	}
+	// Streaming clients would otherwise hold the shutdown until its deadline
+	srv.RegisterOnShutdown(datafetch.Hub.Close)
 
 	cleanup := func() {
 		logger.Info("Cleaning up resources...")
+		datafetch.StopListening()
+		if ticks != nil {
+			service.SetTickRecorder(nil)
+			ticks.Close()
+		}
+		if quarantine != nil {
+			service.SetQuarantine(nil)
+			quarantine.Close()
+		}
+		if aggregateSpool != nil {
+			aggregateSpool.Close()
+		}
+		if err := lineRecorder.Stop(); err != nil && err != domain.ErrRecordingStopped {
+			logger.Error("Failed to stop recording", "error", err)
+		}
+		if compactor != nil {
+			compactor.Close()
+		}
 		cache.Close()
 		repo.Close()
-		datafetch.StopListening()
 	}
 
 	return srv, cleanup
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"fmt"
+	"marketflow/internal/adapters/db"
+	"marketflow/internal/domain"
+	"marketflow/migrations"
+	"marketflow/pkg/logger"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// Migrate runs the migrate command with the arguments following it and returns the exit code.
+// up applies the pending migrations, down [N] reverts the last N (default 1), status lists them.
+func Migrate(args []string) int {
+	logger.Init()
+
+	if len(args) == 0 || len(args) > 2 || (len(args) == 2 && args[0] != "down") {
+		fmt.Println(domain.HelpMessage)
+		return 1
+	}
+
+	steps := 1
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			logger.Error("Number of migrations to revert must be a positive number", "value", args[1])
+			return 1
+		}
+		steps = n
+	}
+
+	all, err := db.LoadMigrations(migrations.FS)
+	if err != nil {
+		logger.Error("Failed to load migrations", "error", err)
+		return 1
+	}
+
+	repo := db.NewPostgres()
+	defer repo.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := repo.MigrateUp(all)
+		if err != nil {
+			logger.Error("Failed to migrate the database", "applied", applied, "error", err)
+			return 1
+		}
+		logger.Info("Database is up to date", "applied", applied)
+	case "down":
+		reverted, err := repo.MigrateDown(all, steps)
+		if err != nil {
+			logger.Error("Failed to revert migrations", "reverted", reverted, "error", err)
+			return 1
+		}
+		logger.Info("Reverted migrations", "reverted", reverted)
+	case "status":
+		statuses, err := repo.MigrationStatus(all)
+		if err != nil {
+			logger.Error("Failed to read migration status", "error", err)
+			return 1
+		}
+		printMigrationStatus(statuses)
+	default:
+		fmt.Println(domain.HelpMessage)
+		return 1
+	}
+
+	return 0
+}
+
+func migrateUp(repo *db.PostgresRepository) error {
+	all, err := db.LoadMigrations(migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	applied, err := repo.MigrateUp(all)
+	if err != nil {
+		return err
+	}
+	logger.Info("Database is up to date", "applied", applied)
+	return nil
+}
+
+func printMigrationStatus(statuses []db.MigrationStatus) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, status := range statuses {
+		name, applied := status.Name, "pending"
+		if name == "" {
+			name = "(unknown to this binary)"
+		}
+		if status.AppliedAt != nil {
+			applied = status.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%03d\t%s\t%s\n", status.Version, name, applied)
+	}
+	w.Flush()
+}
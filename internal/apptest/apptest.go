@@ -0,0 +1,210 @@
+// Package apptest wires the HTTP API to the in-memory adapters and a fetcher driven by the test,
+// so tests can push ticks and assert on the responses.
+package apptest
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"marketflow/internal/adapters/api/handlers"
+	"marketflow/internal/adapters/api/server"
+	"marketflow/internal/adapters/memory"
+	"marketflow/internal/domain"
+	"marketflow/pkg/logger"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Exchanges known to the harness
+var Exchanges = []string{"Exchange1", "Exchange2", "Exchange3"}
+
+// Batching interval of the harness, ticks reach the buffer and the cache within a few of them
+const BatchInterval = 10 * time.Millisecond
+
+type Harness struct {
+	t       testing.TB
+	DB      *memory.Database
+	Cache   *memory.Cache
+	Fetcher *memory.Fetcher
+	Service *server.DataModeServiceImp
+	Server  *httptest.Server
+}
+
+// New starts the service with a fetcher in test mode and serves the API until the test ends.
+// It replaces the process wide exchange and aggregation settings, so tests using it must not run in parallel.
+// They are restored once the test and its cleanups are done.
+func New(t testing.TB) *Harness {
+	t.Helper()
+
+	restore := saveGlobals()
+	t.Cleanup(restore)
+
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+	domain.SetExchanges(Exchanges)
+	domain.BatchInterval = BatchInterval
+	// A day long window keeps the aggregates in the buffer for the whole test
+	domain.AggregationWindow = 24 * time.Hour
+	domain.AllowedLateness = 5 * time.Second
+	domain.LateTicks = domain.LateDrop
+	domain.FlushTimeout = time.Second
+	domain.StaleThreshold = 10 * time.Second
+	domain.StaleThresholds = map[string]time.Duration{}
+	domain.StaleAction = domain.StaleServe
+	domain.TickMaxDeviation = 10
+	domain.TickMedianWindow = 30 * time.Second
+	domain.AdminToken = ""
+
+	h := &Harness{
+		t:       t,
+		DB:      memory.NewDatabase(),
+		Cache:   memory.NewCache(),
+		Fetcher: memory.NewFetcher(domain.ModeTest),
+	}
+
+	h.Service = server.NewDataFetcher(h.Fetcher, h.DB, h.Cache)
+	if err := h.Service.ListenAndSave(); err != nil {
+		t.Fatalf("failed to start the service: %v", err)
+	}
+
+	h.Server = httptest.NewServer(handlers.Setup(h.DB, h.Cache, h.Service))
+	t.Cleanup(func() {
+		h.Server.Close()
+		h.Service.StopListening()
+		h.Service.Hub.Close()
+	})
+
+	return h
+}
+
+// Returns a function putting back the globals New and the tests using it replace
+func saveGlobals() func() {
+	log, exchanges := logger.Log, domain.Exchanges
+	batch, window, lateness, late, flush := domain.BatchInterval, domain.AggregationWindow, domain.AllowedLateness, domain.LateTicks, domain.FlushTimeout
+	threshold, thresholds, action := domain.StaleThreshold, domain.StaleThresholds, domain.StaleAction
+	deviation, median := domain.TickMaxDeviation, domain.TickMedianWindow
+	token := domain.AdminToken
+
+	return func() {
+		logger.Log, domain.Exchanges = log, exchanges
+		domain.BatchInterval, domain.AggregationWindow, domain.AllowedLateness, domain.LateTicks, domain.FlushTimeout = batch, window, lateness, late, flush
+		domain.StaleThreshold, domain.StaleThresholds, domain.StaleAction = threshold, thresholds, action
+		domain.TickMaxDeviation, domain.TickMedianWindow = deviation, median
+		domain.AdminToken = token
+	}
+}
+
+// Push sends the ticks and waits until they are aggregated and stored as the latest price
+func (h *Harness) Push(ticks ...domain.Data) {
+	h.t.Helper()
+
+	if err := h.Fetcher.Push(ticks...); err != nil {
+		h.t.Fatalf("failed to push ticks: %v", err)
+	}
+
+	last := ticks[len(ticks)-1]
+	h.Eventually(func() bool {
+		return h.stored(last) && h.buffered(last)
+	})
+}
+
+// Reports whether the tick is the latest price in the cache or, while the cache fails, in the database
+func (h *Harness) stored(tick domain.Data) bool {
+	if data, err := h.Cache.LatestData(tick.ExchangeName, tick.Symbol); err == nil {
+		return data == tick
+	}
+	data, err := h.DB.LatestDataByExchange(tick.ExchangeName, tick.Symbol)
+	return err == nil && data == tick
+}
+
+// Reports whether the tick made it into the aggregation buffer
+func (h *Harness) buffered(tick domain.Data) bool {
+	aggregated := h.Service.AggregatedDataByDuration(tick.ExchangeName, tick.Symbol, time.Hour)
+	for _, batch := range aggregated {
+		if data := batch[tick.ExchangeName+" "+tick.Symbol]; data.Close_price == tick.Price {
+			return true
+		}
+	}
+	return false
+}
+
+// Eventually fails the test if cond does not hold within a second
+func (h *Harness) Eventually(cond func() bool) {
+	h.t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			h.t.Fatal("condition not met in time")
+		}
+		time.Sleep(BatchInterval)
+	}
+}
+
+// Get requests the path and decodes the JSON body into out, if out is not nil
+func (h *Harness) Get(path string, out any) int {
+	h.t.Helper()
+	return h.do(http.MethodGet, path, out)
+}
+
+// Post requests the path and decodes the JSON body into out, if out is not nil
+func (h *Harness) Post(path string, out any) int {
+	h.t.Helper()
+	return h.do(http.MethodPost, path, out)
+}
+
+func (h *Harness) do(method, path string, out any) int {
+	h.t.Helper()
+
+	code, body := h.Raw(method, path)
+	if out != nil {
+		if err := json.Unmarshal(body, out); err != nil {
+			h.t.Fatalf("%s %s: failed to decode %q: %v", method, path, strings.TrimSpace(string(body)), err)
+		}
+	}
+	return code
+}
+
+// Raw requests the path and returns the status code and the body as is
+func (h *Harness) Raw(method, path string) (int, []byte) {
+	h.t.Helper()
+
+	req, err := http.NewRequest(method, h.Server.URL+path, nil)
+	if err != nil {
+		h.t.Fatalf("failed to build request: %v", err)
+	}
+	resp, err := h.Server.Client().Do(req)
+	if err != nil {
+		h.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		h.t.Fatalf("%s %s: failed to read body: %v", method, path, err)
+	}
+	return resp.StatusCode, body
+}
+
+// Tick builds a tick stamped with the current time
+func Tick(exchange, symbol string, price float64) domain.Data {
+	return domain.Data{ExchangeName: exchange, Symbol: symbol, Price: price, Timestamp: time.Now().UnixMilli()}
+}
+
+// Message is the body of the plain message responses
+type Message struct {
+	Code    int    `json:"Code"`
+	Message string `json:"Message"`
+}
+
+// Metric is the body of the /prices responses
+type Metric struct {
+	Exchange  string  `json:"exchange"`
+	Symbol    string  `json:"symbol"`
+	Price     float64 `json:"price"`
+	Timestamp string  `json:"timestamp"`
+	AgeMs     *int64  `json:"age_ms"`
+	Stale     bool    `json:"stale"`
+}
@@ -3,10 +3,20 @@ package domain
 import "errors"
 
 var (
-	ErrInvalidExchangeVal             = errors.New("exchange value is invalid , must be (Exchange1, Exchange2, Exchange3, All)")
+	ErrInvalidExchangeVal             = errors.New("exchange value is invalid, must be one of the known exchanges")
 	ErrInvalidMetricVal               = errors.New("metric value is invalid , must be (highest, lowest, latest, average)")
 	ErrInvalidSymbolVal               = errors.New("symbol value is invalid , must be (BTCUSDT, DOGEUSDT, TONUSDT, ETHUSDT, SOLUSDT)")
-	ErrInvalidModeVal                 = errors.New("mode value is invalid, must be (test or live)")
+	ErrInvalidModeVal                 = errors.New("mode value is invalid, must be (test, live or replay)")
+	ErrEmptyReplaySource              = errors.New("replay source is empty, must be a file name or db")
+	ErrInvalidReplaySource            = errors.New("replay source is invalid, must be a file in the replay directory or db")
+	ErrInvalidScenario                = errors.New("scenario is invalid")
+	ErrScenarioNotFound               = errors.New("scenario is not found")
+	ErrRecordingStarted               = errors.New("recording is already started")
+	ErrRecordingStopped               = errors.New("recording is already stopped")
+	ErrRecordingNotConfigured         = errors.New("recording is not configured")
+	ErrAdminUnauthorized              = errors.New("admin token is missing or invalid")
+	ErrInvalidRecordingAction         = errors.New("recording action is invalid, must be (start, stop)")
+	ErrInvalidReplaySpeed             = errors.New("replay speed is invalid, must be max or a positive multiplier like 1x or 10x")
 	ErrAllNotSupported                = errors.New(`"All" is not supported for this period-based query`)
 	ErrEmptyMetricVal                 = errors.New("metric value is empty")
 	ErrEmptyExchangeVal               = errors.New("exchange value is empty")
@@ -15,7 +25,15 @@ var (
 	ErrHighPriceWithPeriodNotFound    = errors.New("highest price data is unavailable for the selected period")
 	ErrLowestPriceNotFound            = errors.New("lowest price is not found")
 	ErrLowestPriceWithPeriodNotFound  = errors.New("lowest price data is unavailable for the selected period")
+	ErrCacheMiss                      = errors.New("key is not found in cache")
+	ErrStalePrice                     = errors.New("price is stale, the feed has not updated it within the staleness threshold")
 	ErrLatestPriceNotFound            = errors.New("latest price is not found")
 	ErrAveragePriceNotFound           = errors.New("average price is not found")
 	ErrAveragePriceWithPeriodNotFound = errors.New("average price data is unavailable for the selected period")
+	ErrInvalidInterval                = errors.New("interval is invalid, must be a multiple of the aggregation window that divides 24h evenly")
+	ErrInvalidTimeRange               = errors.New("time range is invalid, from and to must be RFC3339 timestamps with from before to")
+	ErrTooManyCandles                 = errors.New("requested range contains too many candles, narrow the range or increase the interval")
+	ErrCandlesNotFound                = errors.New("candles are unavailable for the selected range")
+	ErrEmptyTimeRange                 = errors.New("from and to query parameters are required")
+	ErrInvalidPagination              = errors.New("pagination is invalid, limit must be between 1 and 5000 and offset must not be negative")
 )
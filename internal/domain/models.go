@@ -18,9 +18,100 @@ type ExchangeData struct {
 	Average_price float64   `json:"average_price"`
 	Min_price     float64   `json:"min_price"`
 	Max_price     float64   `json:"max_price"`
+	Open_price    float64   `json:"open_price"`
+	Close_price   float64   `json:"close_price"`
+	Tick_count    int64     `json:"tick_count"`
+	Price_sum     float64   `json:"price_sum"` // sum of the tick prices, Average_price is Price_sum / Tick_count
+	// Set on aggregates of ticks arriving after their window was flushed, they never move the open or close price
+	Late bool `json:"late,omitempty"`
+	// Set on rows of a window cut short by a shutdown or a mode switch
+	Partial bool `json:"partial,omitempty"`
 }
 
-type ConnMsg struct {
-	Connection string `json:"connection,omitempty"`
-	Status     string `json:"status"`
+// OHLC candle of one exchange and pair starting at OpenTime
+type Candle struct {
+	Exchange string    `json:"exchange"`
+	Symbol   string    `json:"symbol"`
+	OpenTime time.Time `json:"open_time"`
+	Open     float64   `json:"open"`
+	High     float64   `json:"high"`
+	Low      float64   `json:"low"`
+	Close    float64   `json:"close"`
+	Ticks    int64     `json:"ticks"`
+}
+
+// Stored aggregate of one exchange and pair, Timestamp is the start of its window
+type PricePoint struct {
+	Timestamp     time.Time `json:"timestamp"`
+	Average_price float64   `json:"average_price"`
+	Min_price     float64   `json:"min_price"`
+	Max_price     float64   `json:"max_price"`
+	Partial       bool      `json:"partial,omitempty"` // some of its windows were cut short
+}
+
+// Page of the stored aggregate series within an absolute time range
+type PriceHistory struct {
+	Exchange   string       `json:"exchange"`
+	Symbol     string       `json:"symbol"`
+	From       time.Time    `json:"from"`
+	To         time.Time    `json:"to"`
+	Step       string       `json:"step,omitempty"`
+	Points     []PricePoint `json:"points"`
+	NextOffset *int         `json:"next_offset,omitempty"`
+}
+
+// Tick rejected by validation, Median is the price of the other exchanges it deviated from
+type RejectedTick struct {
+	Data
+	Reason   string    `json:"reason"`
+	Median   float64   `json:"median,omitempty"`
+	Received time.Time `json:"received"`
+}
+
+// Freshness of the feed a price response is based on. The age is unknown
+// when no tick of the exchange and symbol was seen, such a price is stale.
+type Freshness struct {
+	AgeMs *int64 `json:"age_ms,omitempty"`
+	Stale bool   `json:"stale"`
+}
+
+// Connection and ingestion stats of one exchange
+type ExchangeHealth struct {
+	Name           string     `json:"name"`
+	State          string     `json:"state"`
+	LastMessage    *time.Time `json:"last_message,omitempty"`
+	MessagesPerSec float64    `json:"messages_per_sec"`
+	ParseErrors    int64      `json:"parse_errors"`
+	Reconnects     int64      `json:"reconnects"`
+	ClockSkewMs    *int64     `json:"clock_skew_ms,omitempty"`
+}
+
+// Reachability of a store and the outcome of the last aggregated data flush into it
+type StoreHealth struct {
+	Status         string     `json:"status"`
+	Error          string     `json:"error,omitempty"`
+	LastFlush      *time.Time `json:"last_flush,omitempty"`
+	LastFlushError string     `json:"last_flush_error,omitempty"`
+}
+
+// Depth of the spool of aggregates waiting for the database
+type SpoolHealth struct {
+	Records   int    `json:"records"`
+	Bytes     int64  `json:"bytes"`
+	Segments  int    `json:"segments"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Health report of the service. Ready is false while no data can be served,
+// the status is degraded while it is served with some parts missing.
+type HealthReport struct {
+	Status       string           `json:"status"`
+	Ready        bool             `json:"ready"`
+	Mode         string           `json:"mode"`
+	FetcherError string           `json:"fetcher_error,omitempty"`
+	Exchanges    []ExchangeHealth `json:"exchanges,omitempty"`
+	BufferSize   int              `json:"buffer_size"`
+	Database     StoreHealth      `json:"database"`
+	Cache        StoreHealth      `json:"cache"`
+	Spool        *SpoolHealth     `json:"spool,omitempty"`
 }
@@ -6,9 +6,44 @@ import "time"
 type DataFetcher interface {
 	SetupDataFetcher() (chan map[string]ExchangeData, chan []Data, error)
 	CheckHealth() error
+	Mode() string
 	Close()
 }
 
+// Implemented by fetchers reading from separate exchange connections
+type ExchangeHealthReporter interface {
+	ExchangeHealth() []ExchangeHealth
+}
+
+// Stores ticks rejected by validation
+type TickQuarantine interface {
+	Quarantine(ticks []RejectedTick)
+	Close()
+}
+
+// Keeps aggregates the database could not take until they are written into it. Write saves them into the
+// database while nothing waits in the spool and appends them otherwise or if the save fails, Append always
+// appends them.
+type AggregateSpool interface {
+	Write(aggregatedData map[string]ExchangeData) error
+	Append(aggregatedData map[string]ExchangeData) error
+	Health() SpoolHealth
+	Close()
+}
+
+type TickRecorder interface {
+	Record(ticks []Data)
+	Close()
+}
+
+type LineRecorder interface {
+	RecordLine(exchange, line string, received time.Time)
+}
+
+type TickReader interface {
+	RawTicks(from, to time.Time) ([]Data, error)
+}
+
 type CacheMemory interface {
 	CheckHealth() error
 	LatestData(exchange, symbol string) (Data, error)
@@ -22,6 +57,9 @@ type Database interface {
 	AvgPriceReader
 	MinPriceReader
 	MaxPriceReader
+	CandleReader
+	HistoryReader
+	TickReader
 	DatabaseHealthChecker
 }
 
@@ -35,10 +73,11 @@ type LatestDataReader interface {
 	LatestDataByAllExchanges(symbol string) (Data, error)
 }
 
+// Averages are weighted by tick count, which is returned along to merge them with buffered data
 type AvgPriceReader interface {
-	AveragePriceByExchange(exchange, symbol string) (Data, error)
-	AveragePriceByAllExchanges(symbol string) (Data, error)
-	AveragePriceWithDuration(exchange, symbol string, startTime time.Time, duration time.Duration) (Data, error)
+	AveragePriceByExchange(exchange, symbol string) (Data, int64, error)
+	AveragePriceByAllExchanges(symbol string) (Data, int64, error)
+	AveragePriceWithDuration(exchange, symbol string, startTime time.Time, duration time.Duration) (Data, int64, error)
 }
 
 type MinPriceReader interface {
@@ -55,6 +94,14 @@ type MaxPriceReader interface {
 	MaxPriceByAllExchangesWithDuration(symbol string, startTime time.Time, duration time.Duration) (Data, error)
 }
 
+type CandleReader interface {
+	Candles(exchange, symbol string, interval time.Duration, from, to time.Time) ([]Candle, error)
+}
+
+type HistoryReader interface {
+	PriceHistory(exchange, symbol string, from, to time.Time, step time.Duration, limit, offset int) ([]PricePoint, error)
+}
+
 type DatabaseHealthChecker interface {
 	CheckHealth() error
 }
@@ -67,6 +114,9 @@ type DataModeService interface {
 	AvgPriceGetter
 	HighestPriceGetter
 	LowestPriceGetter
+	CandleGetter
+	HistoryGetter
+	FreshnessChecker
 	DataManager
 }
 
@@ -99,9 +149,21 @@ type LowestPriceGetter interface {
 	LowestPriceByAllExchangesWithPeriod(symbol string, period string) (Data, int, error)
 }
 
+type CandleGetter interface {
+	Candles(exchange, symbol, interval, from, to string) ([]Candle, int, error)
+}
+
+type HistoryGetter interface {
+	PriceHistory(exchange, symbol, from, to, step, limit, offset string) (PriceHistory, int, error)
+}
+
+type FreshnessChecker interface {
+	Freshness(exchange, symbol string, fallback int64) (Freshness, int, error)
+}
+
 type DataManager interface {
-	SwitchMode(mode string) (int, error)
-	CheckHealth() []ConnMsg
+	SwitchMode(mode string, options map[string]string) (int, error)
+	CheckHealth() HealthReport
 	ListenAndSave() error
 	StopListening()
 }
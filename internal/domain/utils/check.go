@@ -1,6 +1,10 @@
 package utils
 
-import "marketflow/internal/domain"
+import (
+	"fmt"
+	"marketflow/internal/domain"
+	"strings"
+)
 
 func CheckExchangeName(exchange string) error {
 	for _, val := range domain.Exchanges {
@@ -8,7 +12,7 @@ func CheckExchangeName(exchange string) error {
 			return nil
 		}
 	}
-	return domain.ErrInvalidExchangeVal
+	return fmt.Errorf("%w (%s)", domain.ErrInvalidExchangeVal, strings.Join(domain.Exchanges, ", "))
 }
 
 func CheckSymbolName(symbol string) error {
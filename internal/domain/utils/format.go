@@ -0,0 +1,18 @@
+package utils
+
+import (
+	"strings"
+	"time"
+)
+
+// FormatInterval writes the duration the way intervals are usually given, 1m rather than 1m0s
+func FormatInterval(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatInterval(t *testing.T) {
+	tests := []struct {
+		interval time.Duration
+		want     string
+	}{
+		{time.Minute, "1m"},
+		{5 * time.Minute, "5m"},
+		{90 * time.Second, "1m30s"},
+		{time.Hour, "1h"},
+		{24 * time.Hour, "24h"},
+		{time.Hour + 30*time.Minute, "1h30m"},
+		{time.Hour + time.Second, "1h0m1s"},
+		{30 * time.Second, "30s"},
+		{500 * time.Millisecond, "500ms"},
+	}
+	for _, tt := range tests {
+		if got := FormatInterval(tt.interval); got != tt.want {
+			t.Errorf("FormatInterval(%v) = %q, want %q", tt.interval, got, tt.want)
+		}
+	}
+}
@@ -36,18 +36,20 @@ func SendJSON(w http.ResponseWriter, code int, data interface{}) error {
 	return nil
 }
 
-func SendMetricData(w http.ResponseWriter, code int, rawdata domain.Data) error {
+func SendMetricData(w http.ResponseWriter, code int, rawdata domain.Data, freshness domain.Freshness) error {
 	data := struct {
 		ExchangeName string  `json:"exchange"`
 		Symbol       string  `json:"symbol"`
 		Price        float64 `json:"price"`
 		Timestamp    string  `json:"timestamp"`
+		domain.Freshness
 	}{
 		ExchangeName: rawdata.ExchangeName,
 		Symbol:       rawdata.Symbol,
 		Price:        rawdata.Price,
 		Timestamp: time.Unix(0, rawdata.Timestamp*int64(time.Millisecond)).
 			Format("2006-01-02 15:04:05"),
+		Freshness: freshness,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
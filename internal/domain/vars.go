@@ -1,6 +1,39 @@
 package domain
 
-import "flag"
+import (
+	"flag"
+	"time"
+)
+
+// Data modes
+const (
+	ModeLive   string = "live"
+	ModeTest   string = "test"
+	ModeReplay string = "replay"
+)
+
+// Connection states of a live exchange
+const (
+	ConnConnected    string = "connected"
+	ConnReconnecting string = "reconnecting"
+	ConnFailed       string = "failed"
+)
+
+// Health statuses of the service and its stores
+const (
+	HealthHealthy   string = "healthy"
+	HealthDegraded  string = "degraded"
+	HealthUnhealthy string = "unhealthy"
+)
+
+// Directories replay files and test scenarios are read from, replaced at startup from configuration
+var (
+	ReplayDir   = "replays"
+	ScenarioDir = "scenarios"
+)
+
+// Bearer token the admin API requires, empty leaves it open. Replaced at startup from configuration.
+var AdminToken = ""
 
 // Currencies
 const (
@@ -13,11 +46,88 @@ const (
 
 var Symbols = []string{BTCUSDT, DOGEUSDT, TONUSDT, SOLUSDT, ETHUSDT}
 
+// Exchanges holds the configured exchange names followed by "All".
+// It is replaced by SetExchanges at startup and must not be modified afterwards.
 var Exchanges = []string{"Exchange1", "Exchange2", "Exchange3", "All"}
 
+// SetExchanges replaces the list of known exchanges with the configured ones
+func SetExchanges(names []string) {
+	exchanges := make([]string, 0, len(names)+1)
+	exchanges = append(exchanges, names...)
+	Exchanges = append(exchanges, "All")
+}
+
+// ExchangeNames returns the configured exchange names without "All"
+func ExchangeNames() []string {
+	return Exchanges[:len(Exchanges)-1]
+}
+
+// Aggregation timing, replaced at startup from configuration
+var (
+	// Length of the wall-clock aligned window persisted as one AggregatedData row
+	AggregationWindow = time.Minute
+	// How often raw exchange data is batched before aggregation
+	BatchInterval = time.Second
+	// How long after its end a window still takes ticks before it is flushed
+	AllowedLateness = 5 * time.Second
+	// What happens to ticks arriving after their window was flushed
+	LateTicks = LateDrop
+	// How long the final flush on shutdown and mode switch may take
+	FlushTimeout = 10 * time.Second
+)
+
+// Actions on a tick arriving after its window was flushed
+const (
+	LateDrop    string = "drop"
+	LateCorrect string = "correct"
+)
+
+// Reasons a tick is rejected for
+const (
+	RejectNotFinite     string = "not_finite"
+	RejectNonPositive   string = "non_positive"
+	RejectUnknownSymbol string = "unknown_symbol"
+	RejectDeviation     string = "deviation"
+)
+
+// Tick validation, replaced at startup from configuration
+var (
+	// Largest deviation in percent from the median of the other exchanges, zero disables the check
+	TickMaxDeviation = 10.0
+	// How far back prices of the other exchanges count for the median
+	TickMedianWindow = 30 * time.Second
+)
+
+// Actions on a stale price
+const (
+	StaleServe       string = "serve" // answer with the stale flag set
+	StaleUnavailable string = "503"
+	StaleNotFound    string = "404"
+)
+
+// Staleness of price responses, replaced at startup from configuration
+var (
+	// Age after which the price of a symbol is stale, unless the symbol has its own threshold
+	StaleThreshold  = 10 * time.Second
+	StaleThresholds = map[string]time.Duration{}
+	// What a price request gets when the price is stale
+	StaleAction = StaleServe
+)
+
+// StaleThresholdFor returns the staleness threshold of the symbol
+func StaleThresholdFor(symbol string) time.Duration {
+	if threshold, ok := StaleThresholds[symbol]; ok {
+		return threshold
+	}
+	return StaleThreshold
+}
+
 // Flags
 var (
 	Port        = flag.String("port", "8080", "Establishes server port number")
+	WindowFlag  = flag.String("window", "", "Aggregation window, overrides AGGREGATOR_WINDOW")
+	BatchFlag   = flag.String("batch-interval", "", "Batching interval, overrides AGGREGATOR_BATCH_INTERVAL")
+	MigrateFlag = flag.Bool("migrate", false, "Apply pending schema migrations at startup")
 	HelpFlag    = flag.Bool("help", false, "Show help message")
-	HelpMessage = "Usage:\n   marketflow [--port <N>]\n   marketflow --help\n\nOptions:\n   --port N\tPort number"
+	HelpMessage = "Usage:\n   marketflow [--port <N>] [--window <D>] [--batch-interval <D>] [--migrate]\n   marketflow migrate up|down [N]|status\n   marketflow --help\n\nOptions:\n   --port N\t\tPort number\n   --window D\t\tAggregation window (default 1m), must divide 24h evenly\n   --batch-interval D\tBatching interval (default 1s), must not exceed the window\n   --migrate\t\tApply pending schema migrations at startup\n\nCommands:\n   migrate up\t\tApply the pending schema migrations\n   migrate down [N]\tRevert the last N applied migrations (default 1)\n   migrate status\tList the migrations and when they were applied"
 )
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS LatestData;
+DROP TABLE IF EXISTS AggregatedData;
@@ -1,4 +1,4 @@
-CREATE TABLE AggregatedData(
+CREATE TABLE IF NOT EXISTS AggregatedData(
     Data_id SERIAL PRIMARY KEY,
     Pair_name VARCHAR NOT NULL,
     Exchange VARCHAR(100) NOT NULL,
@@ -8,7 +8,7 @@ CREATE TABLE AggregatedData(
     Max_price FLOAT NOT NULL
 );
 
-CREATE TABLE LatestData(
+CREATE TABLE IF NOT EXISTS LatestData(
     Exchange VARCHAR(100) NOT NULL,
     Pair_name VARCHAR NOT NULL,
     Price FLOAT NOT NULL,
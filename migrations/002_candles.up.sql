@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS Candles(
+    Pair_name VARCHAR NOT NULL,
+    Exchange VARCHAR(100) NOT NULL,
+    OpenTime TimestampTZ NOT NULL,
+    Open_price FLOAT NOT NULL,
+    High_price FLOAT NOT NULL,
+    Low_price FLOAT NOT NULL,
+    Close_price FLOAT NOT NULL,
+    Tick_count BIGINT NOT NULL,
+    CONSTRAINT unique_candle UNIQUE (Exchange, Pair_name, OpenTime)
+);
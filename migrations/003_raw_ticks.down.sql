@@ -0,0 +1,2 @@
+-- Drops the daily partitions along with the table
+DROP TABLE IF EXISTS RawTicks;
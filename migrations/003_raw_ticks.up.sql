@@ -0,0 +1,10 @@
+-- Every price received from the exchanges, partitions are created daily by the application
+CREATE TABLE IF NOT EXISTS RawTicks(
+    Exchange VARCHAR(100) NOT NULL,
+    Pair_name VARCHAR NOT NULL,
+    Price FLOAT NOT NULL,
+    ExchangeTime BIGINT NOT NULL,
+    ReceivedTime TimestampTZ NOT NULL
+) PARTITION BY RANGE (ReceivedTime);
+
+CREATE INDEX IF NOT EXISTS idx_rawticks_pair_time ON RawTicks (Pair_name, Exchange, ReceivedTime);
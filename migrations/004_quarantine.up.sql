@@ -0,0 +1,12 @@
+-- Ticks rejected by validation before aggregation, with the median of the other exchanges for deviations
+CREATE TABLE IF NOT EXISTS QuarantinedTicks(
+    Exchange VARCHAR(100) NOT NULL,
+    Pair_name VARCHAR NOT NULL,
+    Price FLOAT NOT NULL,
+    ExchangeTime BIGINT NOT NULL,
+    ReceivedTime TimestampTZ NOT NULL,
+    Reason VARCHAR(32) NOT NULL,
+    Median FLOAT
+);
+
+CREATE INDEX IF NOT EXISTS idx_quarantinedticks_time ON QuarantinedTicks (ReceivedTime);
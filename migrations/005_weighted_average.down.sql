@@ -0,0 +1,3 @@
+ALTER TABLE AggregatedData
+    DROP COLUMN IF EXISTS Tick_count,
+    DROP COLUMN IF EXISTS Price_sum;
@@ -0,0 +1,11 @@
+-- Tick counts and price sums make averages across rows weighted by ticks instead of averages of averages.
+-- Rows stored before carry no count, each of them weighs as a single tick.
+ALTER TABLE AggregatedData
+    ADD COLUMN IF NOT EXISTS Tick_count BIGINT NOT NULL DEFAULT 1,
+    ADD COLUMN IF NOT EXISTS Price_sum FLOAT;
+
+UPDATE AggregatedData SET Price_sum = Average_price WHERE Price_sum IS NULL;
+
+ALTER TABLE AggregatedData
+    ALTER COLUMN Tick_count DROP DEFAULT,
+    ALTER COLUMN Price_sum SET NOT NULL;
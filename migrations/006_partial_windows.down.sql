@@ -0,0 +1 @@
+ALTER TABLE AggregatedData DROP COLUMN IF EXISTS Partial;
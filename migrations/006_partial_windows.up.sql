@@ -0,0 +1,2 @@
+-- Marks rows of a window cut short by a shutdown or a mode switch
+ALTER TABLE AggregatedData ADD COLUMN IF NOT EXISTS Partial BOOLEAN NOT NULL DEFAULT FALSE;
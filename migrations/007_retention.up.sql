@@ -0,0 +1,16 @@
+-- Aggregates rolled up into coarser resolutions by the retention job, Resolution is in seconds
+CREATE TABLE IF NOT EXISTS AggregatedRollups(
+    Resolution INTEGER NOT NULL,
+    Pair_name VARCHAR NOT NULL,
+    Exchange VARCHAR(100) NOT NULL,
+    StoredTime TimestampTZ NOT NULL,
+    Average_price FLOAT NOT NULL,
+    Min_price FLOAT NOT NULL,
+    Max_price FLOAT NOT NULL,
+    Tick_count BIGINT NOT NULL,
+    Price_sum FLOAT NOT NULL,
+    Partial BOOLEAN NOT NULL DEFAULT FALSE,
+    CONSTRAINT unique_rollup UNIQUE (Resolution, Exchange, Pair_name, StoredTime)
+);
+
+CREATE INDEX IF NOT EXISTS idx_aggregatedrollups_time ON AggregatedRollups (Resolution, StoredTime);
@@ -0,0 +1,23 @@
+ALTER TABLE AggregatedData RENAME TO AggregatedData_partitioned;
+ALTER TABLE AggregatedData_partitioned RENAME CONSTRAINT aggregateddata_pkey TO aggregateddata_partitioned_pkey;
+
+CREATE TABLE AggregatedData(
+    Data_id BIGINT PRIMARY KEY DEFAULT nextval('aggregateddata_data_id_seq'),
+    Pair_name VARCHAR NOT NULL,
+    Exchange VARCHAR(100) NOT NULL,
+    StoredTime TimestampTZ DEFAULT NOW(),
+    Average_price FLOAT NOT NULL,
+    Min_price FLOAT NOT NULL,
+    Max_price FLOAT NOT NULL,
+    Tick_count BIGINT NOT NULL,
+    Price_sum FLOAT NOT NULL,
+    Partial BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+INSERT INTO AggregatedData (Data_id, Pair_name, Exchange, StoredTime, Average_price, Min_price, Max_price, Tick_count, Price_sum, Partial)
+SELECT Data_id, Pair_name, Exchange, StoredTime, Average_price, Min_price, Max_price, Tick_count, Price_sum, Partial
+FROM AggregatedData_partitioned;
+
+ALTER SEQUENCE aggregateddata_data_id_seq OWNED BY AggregatedData.Data_id;
+-- Drops the monthly partitions along with the table
+DROP TABLE AggregatedData_partitioned;
@@ -0,0 +1,49 @@
+-- AggregatedData becomes range partitioned by StoredTime into monthly partitions named aggregateddata_YYYYMM (UTC).
+-- Partitions holding the existing rows and the current month are created here, the application creates the later ones.
+ALTER TABLE AggregatedData RENAME TO AggregatedData_old;
+ALTER TABLE AggregatedData_old RENAME CONSTRAINT aggregateddata_pkey TO aggregateddata_old_pkey;
+
+CREATE TABLE AggregatedData(
+    Data_id BIGINT NOT NULL DEFAULT nextval('aggregateddata_data_id_seq'),
+    Pair_name VARCHAR NOT NULL,
+    Exchange VARCHAR(100) NOT NULL,
+    StoredTime TimestampTZ NOT NULL DEFAULT NOW(),
+    Average_price FLOAT NOT NULL,
+    Min_price FLOAT NOT NULL,
+    Max_price FLOAT NOT NULL,
+    Tick_count BIGINT NOT NULL,
+    Price_sum FLOAT NOT NULL,
+    Partial BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (Data_id, StoredTime)
+) PARTITION BY RANGE (StoredTime);
+
+DO $$
+DECLARE
+    partition_month TIMESTAMP;
+BEGIN
+    FOR partition_month IN
+        SELECT DISTINCT date_trunc('month', StoredTime AT TIME ZONE 'UTC') FROM AggregatedData_old WHERE StoredTime IS NOT NULL
+        UNION
+        SELECT date_trunc('month', NOW() AT TIME ZONE 'UTC')
+    LOOP
+        EXECUTE format(
+            'CREATE TABLE aggregateddata_%s PARTITION OF AggregatedData FOR VALUES FROM (%L) TO (%L)',
+            to_char(partition_month, 'YYYYMM'), partition_month AT TIME ZONE 'UTC', (partition_month + INTERVAL '1 month') AT TIME ZONE 'UTC'
+        );
+    END LOOP;
+END $$;
+
+-- Rows without a time were never matched by a period query and can not be placed in a partition
+INSERT INTO AggregatedData (Data_id, Pair_name, Exchange, StoredTime, Average_price, Min_price, Max_price, Tick_count, Price_sum, Partial)
+SELECT Data_id, Pair_name, Exchange, StoredTime, Average_price, Min_price, Max_price, Tick_count, Price_sum, Partial
+FROM AggregatedData_old
+WHERE StoredTime IS NOT NULL;
+
+ALTER SEQUENCE aggregateddata_data_id_seq AS BIGINT OWNED BY AggregatedData.Data_id;
+DROP TABLE AggregatedData_old;
+
+-- Every query filters on the exchange and the pair, then on the time or orders by the lowest or highest price.
+-- The sums of the averages are included, so they are read from the index alone.
+CREATE INDEX idx_aggregateddata_pair_time ON AggregatedData (Exchange, Pair_name, StoredTime) INCLUDE (Tick_count, Price_sum);
+CREATE INDEX idx_aggregateddata_pair_min ON AggregatedData (Exchange, Pair_name, Min_price);
+CREATE INDEX idx_aggregateddata_pair_max ON AggregatedData (Exchange, Pair_name, Max_price);
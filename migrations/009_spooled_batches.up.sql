@@ -0,0 +1,7 @@
+-- Spool records written into the database, stored in the transaction of their rows so a replay after a crash is skipped
+CREATE TABLE IF NOT EXISTS SpooledBatches(
+    Batch_id VARCHAR PRIMARY KEY,
+    SavedAt TimestampTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_spooledbatches_savedat ON SpooledBatches (SavedAt);
@@ -0,0 +1,6 @@
+-- Window start times of aggregates saved after a rollup may already have passed their bucket,
+-- the retention job rolls those buckets up again and removes the rows
+CREATE TABLE IF NOT EXISTS RollupPending(
+    StoredTime TimestampTZ PRIMARY KEY,
+    MarkedAt TimestampTZ NOT NULL DEFAULT NOW()
+);
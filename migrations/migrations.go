@@ -0,0 +1,7 @@
+// Package migrations embeds the numbered schema migrations, NNN_name.up.sql and NNN_name.down.sql
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -2,7 +2,13 @@ package config
 
 import (
 	"errors"
+	"fmt"
+	"math"
+	"net"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type RedisConfig struct {
@@ -19,7 +25,78 @@ type DBConfig struct {
 	Name     string
 }
 
+type AggregatorConfig struct {
+	Window          time.Duration
+	BatchInterval   time.Duration
+	AllowedLateness time.Duration
+	LateTicks       string
+	FlushTimeout    time.Duration
+}
+
+type RawTickConfig struct {
+	Enabled       bool
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+type RecordConfig struct {
+	Enabled bool
+	Dir     string
+	MaxSize int64
+	MaxAge  time.Duration
+}
+
+type TestModeConfig struct {
+	Seed         int64
+	Drift        float64
+	Volatility   float64
+	SpreadBps    float64
+	TickInterval time.Duration
+}
+
+type ReconnectConfig struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Multiplier      float64
+	Jitter          float64
+	MaxAttempts     int // 0 means unlimited
+}
+
+type StalenessConfig struct {
+	Threshold  time.Duration
+	Thresholds map[string]time.Duration // per symbol
+	Action     string
+}
+
+type TickFilterConfig struct {
+	MaxDeviation      float64 // percent, zero disables the check
+	MedianWindow      time.Duration
+	QuarantineEnabled bool
+}
+
+type SpoolConfig struct {
+	Enabled          bool
+	Dir              string
+	SegmentSize      int64
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+}
+
+// A coarser resolution the stored aggregates are rolled up to
+type RetentionTier struct {
+	Resolution time.Duration
+	Retention  time.Duration // 0 keeps the rows forever
+}
+
+type RetentionConfig struct {
+	Enabled  bool
+	Base     time.Duration // retention of the window rows, 0 keeps them forever
+	Tiers    []RetentionTier
+	Interval time.Duration
+}
+
 type ExchangeConfig struct {
+	Names     []string
 	Ports     []string
 	ExchHosts []string
 }
@@ -60,21 +137,583 @@ func LoadDBConfig() (*DBConfig, error) {
 	}, nil
 }
 
+// LoadExchangeConfig reads the exchange list from EXCHANGES, a comma separated list
+// of [name=]host:port entries. Without EXCHANGES it falls back to the numbered
+// EXCHANGE<N>_NAME / EXCHANGE<N>_PORT variables, reading them until the first gap.
+// Exchanges without an explicit name are called Exchange<N> by their position.
 func LoadExchangeConfig() (*ExchangeConfig, error) {
-	port1 := os.Getenv("EXCHANGE1_PORT")
-	port2 := os.Getenv("EXCHANGE2_PORT")
-	port3 := os.Getenv("EXCHANGE3_PORT")
+	cfg := &ExchangeConfig{}
+
+	if list := os.Getenv("EXCHANGES"); list != "" {
+		for i, entry := range strings.Split(list, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+
+			name := "Exchange" + strconv.Itoa(i+1)
+			if n, addr, ok := strings.Cut(entry, "="); ok {
+				name, entry = strings.TrimSpace(n), strings.TrimSpace(addr)
+			}
+
+			host, port, err := net.SplitHostPort(entry)
+			if err != nil || name == "" || host == "" || port == "" {
+				return nil, fmt.Errorf("invalid EXCHANGES entry %q, expected [name=]host:port", entry)
+			}
+
+			if err := cfg.add(name, host, port); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		for i := 1; ; i++ {
+			host := os.Getenv("EXCHANGE" + strconv.Itoa(i) + "_NAME")
+			port := os.Getenv("EXCHANGE" + strconv.Itoa(i) + "_PORT")
+			if host == "" || port == "" {
+				break
+			}
+
+			if err := cfg.add("Exchange"+strconv.Itoa(i), host, port); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(cfg.Names) == 0 {
+		return nil, errors.New("no exchanges configured, set EXCHANGES or EXCHANGE<N>_NAME and EXCHANGE<N>_PORT env vars")
+	}
+
+	return cfg, nil
+}
+
+func (c *ExchangeConfig) add(name, host, port string) error {
+	if name == "All" {
+		return errors.New(`exchange name "All" is reserved`)
+	}
+
+	for _, n := range c.Names {
+		if n == name {
+			return fmt.Errorf("duplicate exchange name %q", name)
+		}
+	}
+
+	c.Names = append(c.Names, name)
+	c.ExchHosts = append(c.ExchHosts, host)
+	c.Ports = append(c.Ports, port)
+	return nil
+}
+
+// LoadAggregatorConfig resolves the aggregation window and the batching interval.
+// Non-empty arguments (command line flags) take precedence over AGGREGATOR_WINDOW
+// and AGGREGATOR_BATCH_INTERVAL, which take precedence over the 1m / 1s defaults.
+// AGGREGATOR_ALLOWED_LATENESS defaults to 5s or two batch intervals if that is longer,
+// AGGREGATOR_LATE_TICKS to drop and AGGREGATOR_FLUSH_TIMEOUT, the limit of the final flush, to 10s.
+func LoadAggregatorConfig(window, batchInterval string) (*AggregatorConfig, error) {
+	if window == "" {
+		window = os.Getenv("AGGREGATOR_WINDOW")
+	}
+	if window == "" {
+		window = "1m"
+	}
+
+	if batchInterval == "" {
+		batchInterval = os.Getenv("AGGREGATOR_BATCH_INTERVAL")
+	}
+	if batchInterval == "" {
+		batchInterval = "1s"
+	}
 
-	host1 := os.Getenv("EXCHANGE1_NAME")
-	host2 := os.Getenv("EXCHANGE2_NAME")
-	host3 := os.Getenv("EXCHANGE3_NAME")
+	w, err := time.ParseDuration(window)
+	if err != nil {
+		return nil, fmt.Errorf("invalid aggregator window %q: %w", window, err)
+	}
+
+	b, err := time.ParseDuration(batchInterval)
+	if err != nil {
+		return nil, fmt.Errorf("invalid aggregator batch interval %q: %w", batchInterval, err)
+	}
+
+	// Windows are aligned to wall-clock boundaries, so they have to split a day evenly
+	if w < time.Second || w > 24*time.Hour || (24*time.Hour)%w != 0 {
+		return nil, fmt.Errorf("aggregator window %s must be between 1s and 24h and divide 24h evenly", w)
+	}
+
+	if b <= 0 || b > w {
+		return nil, fmt.Errorf("aggregator batch interval %s must be positive and not longer than the window %s", b, w)
+	}
+
+	// A tick reaches the window flush up to a batch interval after it was received
+	lateness := max(5*time.Second, 2*b)
+	if raw := os.Getenv("AGGREGATOR_ALLOWED_LATENESS"); raw != "" {
+		lateness, err = time.ParseDuration(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid aggregator allowed lateness %q: %w", raw, err)
+		}
+		if lateness < b {
+			return nil, fmt.Errorf("aggregator allowed lateness %s must not be shorter than the batch interval %s", lateness, b)
+		}
+	}
+
+	lateTicks := os.Getenv("AGGREGATOR_LATE_TICKS")
+	switch lateTicks {
+	case "":
+		lateTicks = "drop"
+	case "drop", "correct":
+	default:
+		return nil, fmt.Errorf("invalid AGGREGATOR_LATE_TICKS %q, must be drop or correct", lateTicks)
+	}
 
-	if port1 == "" || port2 == "" || port3 == "" || host1 == "" || host2 == "" || host3 == "" {
-		return nil, errors.New("one or more EXCHANGE_* env vars are missing")
+	flushTimeout := 10 * time.Second
+	if raw := os.Getenv("AGGREGATOR_FLUSH_TIMEOUT"); raw != "" {
+		flushTimeout, err = time.ParseDuration(raw)
+		if err != nil || flushTimeout <= 0 {
+			return nil, fmt.Errorf("invalid aggregator flush timeout %q, must be a positive duration", raw)
+		}
 	}
 
-	return &ExchangeConfig{
-		Ports:     []string{port1, port2, port3},
-		ExchHosts: []string{host1, host2, host3},
+	return &AggregatorConfig{
+		Window:          w,
+		BatchInterval:   b,
+		AllowedLateness: lateness,
+		LateTicks:       lateTicks,
+		FlushTimeout:    flushTimeout,
 	}, nil
 }
+
+// LoadRawTickConfig reads the optional raw tick store settings.
+// The store is disabled unless RAW_TICKS_ENABLED is true.
+func LoadRawTickConfig() (*RawTickConfig, error) {
+	cfg := &RawTickConfig{
+		BatchSize:     5000,
+		FlushInterval: time.Second,
+	}
+
+	if enabled := os.Getenv("RAW_TICKS_ENABLED"); enabled != "" {
+		val, err := strconv.ParseBool(enabled)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RAW_TICKS_ENABLED %q: %w", enabled, err)
+		}
+		cfg.Enabled = val
+	}
+
+	if size := os.Getenv("RAW_TICKS_BATCH_SIZE"); size != "" {
+		val, err := strconv.Atoi(size)
+		if err != nil || val < 1 {
+			return nil, fmt.Errorf("invalid RAW_TICKS_BATCH_SIZE %q, must be a positive number", size)
+		}
+		cfg.BatchSize = val
+	}
+
+	if interval := os.Getenv("RAW_TICKS_FLUSH_INTERVAL"); interval != "" {
+		val, err := time.ParseDuration(interval)
+		if err != nil || val <= 0 {
+			return nil, fmt.Errorf("invalid RAW_TICKS_FLUSH_INTERVAL %q, must be a positive duration", interval)
+		}
+		cfg.FlushInterval = val
+	}
+
+	return cfg, nil
+}
+
+// LoadReplayDir returns the directory replay files are read from, REPLAY_DIR or "replays"
+func LoadReplayDir() string {
+	if dir := os.Getenv("REPLAY_DIR"); dir != "" {
+		return dir
+	}
+	return "replays"
+}
+
+// LoadScenarioDir returns the directory test scenarios are read from, SCENARIO_DIR or "scenarios"
+func LoadScenarioDir() string {
+	if dir := os.Getenv("SCENARIO_DIR"); dir != "" {
+		return dir
+	}
+	return "scenarios"
+}
+
+// LoadAdminToken returns ADMIN_TOKEN, the bearer token the admin API requires. Empty leaves the admin API open.
+func LoadAdminToken() string {
+	return os.Getenv("ADMIN_TOKEN")
+}
+
+// LoadRecordConfig reads the live feed recorder settings. Files go to RECORD_DIR,
+// which defaults to the replay directory, so recordings can be replayed right away.
+func LoadRecordConfig() (*RecordConfig, error) {
+	cfg := &RecordConfig{
+		Dir:     os.Getenv("RECORD_DIR"),
+		MaxSize: 64 << 20,
+		MaxAge:  time.Hour,
+	}
+	if cfg.Dir == "" {
+		cfg.Dir = LoadReplayDir()
+	}
+
+	if enabled := os.Getenv("RECORD_ENABLED"); enabled != "" {
+		val, err := strconv.ParseBool(enabled)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RECORD_ENABLED %q: %w", enabled, err)
+		}
+		cfg.Enabled = val
+	}
+
+	if size := os.Getenv("RECORD_MAX_SIZE"); size != "" {
+		val, err := strconv.ParseInt(size, 10, 64)
+		if err != nil || val < 1 {
+			return nil, fmt.Errorf("invalid RECORD_MAX_SIZE %q, must be a positive number of bytes", size)
+		}
+		cfg.MaxSize = val
+	}
+
+	if age := os.Getenv("RECORD_MAX_AGE"); age != "" {
+		val, err := time.ParseDuration(age)
+		if err != nil || val < time.Second {
+			return nil, fmt.Errorf("invalid RECORD_MAX_AGE %q, must be a duration of at least 1s", age)
+		}
+		cfg.MaxAge = val
+	}
+
+	return cfg, nil
+}
+
+// LoadTestModeConfig reads the test mode generator settings. Drift and volatility are annualized,
+// the spread is the largest per-exchange offset from the mid price in basis points.
+// Without TEST_SEED a random seed is used.
+func LoadTestModeConfig() (*TestModeConfig, error) {
+	cfg := &TestModeConfig{
+		Seed:         time.Now().UnixNano(),
+		Drift:        0,
+		Volatility:   0.8,
+		SpreadBps:    5,
+		TickInterval: 50 * time.Millisecond,
+	}
+
+	if seed := os.Getenv("TEST_SEED"); seed != "" {
+		val, err := strconv.ParseInt(seed, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TEST_SEED %q: %w", seed, err)
+		}
+		cfg.Seed = val
+	}
+
+	floats := []struct {
+		env string
+		dst *float64
+		min float64
+	}{
+		{"TEST_DRIFT", &cfg.Drift, math.Inf(-1)},
+		{"TEST_VOLATILITY", &cfg.Volatility, 0},
+		{"TEST_SPREAD_BPS", &cfg.SpreadBps, 0},
+	}
+	for _, f := range floats {
+		raw := os.Getenv(f.env)
+		if raw == "" {
+			continue
+		}
+
+		val, err := strconv.ParseFloat(raw, 64)
+		if err != nil || math.IsNaN(val) || math.IsInf(val, 0) || val < f.min {
+			return nil, fmt.Errorf("invalid %s %q", f.env, raw)
+		}
+		*f.dst = val
+	}
+
+	if interval := os.Getenv("TEST_TICK_INTERVAL"); interval != "" {
+		val, err := time.ParseDuration(interval)
+		if err != nil || val < time.Millisecond {
+			return nil, fmt.Errorf("invalid TEST_TICK_INTERVAL %q, must be a duration of at least 1ms", interval)
+		}
+		cfg.TickInterval = val
+	}
+
+	return cfg, nil
+}
+
+// LoadReconnectConfig reads the reconnect policy of the live exchanges. The delay starts at the
+// initial interval and grows by the multiplier up to the max interval, every delay is randomized
+// by up to the jitter fraction. Zero RECONNECT_MAX_ATTEMPTS keeps reconnecting forever.
+func LoadReconnectConfig() (*ReconnectConfig, error) {
+	cfg := &ReconnectConfig{
+		InitialInterval: time.Second,
+		MaxInterval:     30 * time.Second,
+		Multiplier:      2,
+		Jitter:          0.2,
+		MaxAttempts:     0,
+	}
+
+	durations := []struct {
+		env string
+		dst *time.Duration
+	}{
+		{"RECONNECT_INITIAL_INTERVAL", &cfg.InitialInterval},
+		{"RECONNECT_MAX_INTERVAL", &cfg.MaxInterval},
+	}
+	for _, d := range durations {
+		raw := os.Getenv(d.env)
+		if raw == "" {
+			continue
+		}
+
+		val, err := time.ParseDuration(raw)
+		if err != nil || val <= 0 {
+			return nil, fmt.Errorf("invalid %s %q, must be a positive duration", d.env, raw)
+		}
+		*d.dst = val
+	}
+	if cfg.MaxInterval < cfg.InitialInterval {
+		return nil, fmt.Errorf("RECONNECT_MAX_INTERVAL %s is shorter than RECONNECT_INITIAL_INTERVAL %s", cfg.MaxInterval, cfg.InitialInterval)
+	}
+
+	if raw := os.Getenv("RECONNECT_MULTIPLIER"); raw != "" {
+		val, err := strconv.ParseFloat(raw, 64)
+		if err != nil || math.IsNaN(val) || math.IsInf(val, 0) || val < 1 {
+			return nil, fmt.Errorf("invalid RECONNECT_MULTIPLIER %q, must be at least 1", raw)
+		}
+		cfg.Multiplier = val
+	}
+
+	if raw := os.Getenv("RECONNECT_JITTER"); raw != "" {
+		val, err := strconv.ParseFloat(raw, 64)
+		if err != nil || math.IsNaN(val) || val < 0 || val > 1 {
+			return nil, fmt.Errorf("invalid RECONNECT_JITTER %q, must be between 0 and 1", raw)
+		}
+		cfg.Jitter = val
+	}
+
+	if raw := os.Getenv("RECONNECT_MAX_ATTEMPTS"); raw != "" {
+		val, err := strconv.Atoi(raw)
+		if err != nil || val < 0 {
+			return nil, fmt.Errorf("invalid RECONNECT_MAX_ATTEMPTS %q, must be 0 (unlimited) or more", raw)
+		}
+		cfg.MaxAttempts = val
+	}
+
+	return cfg, nil
+}
+
+// LoadStalenessConfig reads when a price is stale and what a request for it gets.
+// STALE_THRESHOLD applies to every symbol without its own STALE_THRESHOLD_<SYMBOL>,
+// STALE_ACTION is serve (the default, the response is flagged), 503 or 404.
+func LoadStalenessConfig(symbols []string) (*StalenessConfig, error) {
+	cfg := &StalenessConfig{
+		Threshold:  10 * time.Second,
+		Thresholds: make(map[string]time.Duration),
+		Action:     "serve",
+	}
+
+	if raw := os.Getenv("STALE_THRESHOLD"); raw != "" {
+		val, err := time.ParseDuration(raw)
+		if err != nil || val <= 0 {
+			return nil, fmt.Errorf("invalid STALE_THRESHOLD %q, must be a positive duration", raw)
+		}
+		cfg.Threshold = val
+	}
+
+	for _, symbol := range symbols {
+		env := "STALE_THRESHOLD_" + symbol
+		raw := os.Getenv(env)
+		if raw == "" {
+			continue
+		}
+
+		val, err := time.ParseDuration(raw)
+		if err != nil || val <= 0 {
+			return nil, fmt.Errorf("invalid %s %q, must be a positive duration", env, raw)
+		}
+		cfg.Thresholds[symbol] = val
+	}
+
+	if action := os.Getenv("STALE_ACTION"); action != "" {
+		switch action {
+		case "serve", "503", "404":
+			cfg.Action = action
+		default:
+			return nil, fmt.Errorf("invalid STALE_ACTION %q, must be serve, 503 or 404", action)
+		}
+	}
+
+	return cfg, nil
+}
+
+// LoadTickFilterConfig reads the tick validation settings. Ticks deviating more than TICK_MAX_DEVIATION
+// percent from the median of the other exchanges over TICK_MEDIAN_WINDOW are rejected, rejected ticks
+// are stored in the quarantine table if QUARANTINE_ENABLED is true.
+func LoadTickFilterConfig() (*TickFilterConfig, error) {
+	cfg := &TickFilterConfig{
+		MaxDeviation: 10,
+		MedianWindow: 30 * time.Second,
+	}
+
+	if raw := os.Getenv("TICK_MAX_DEVIATION"); raw != "" {
+		val, err := strconv.ParseFloat(raw, 64)
+		if err != nil || math.IsNaN(val) || math.IsInf(val, 0) || val < 0 {
+			return nil, fmt.Errorf("invalid TICK_MAX_DEVIATION %q, must be a percentage, 0 disables the check", raw)
+		}
+		cfg.MaxDeviation = val
+	}
+
+	if raw := os.Getenv("TICK_MEDIAN_WINDOW"); raw != "" {
+		val, err := time.ParseDuration(raw)
+		if err != nil || val <= 0 {
+			return nil, fmt.Errorf("invalid TICK_MEDIAN_WINDOW %q, must be a positive duration", raw)
+		}
+		cfg.MedianWindow = val
+	}
+
+	if enabled := os.Getenv("QUARANTINE_ENABLED"); enabled != "" {
+		val, err := strconv.ParseBool(enabled)
+		if err != nil {
+			return nil, fmt.Errorf("invalid QUARANTINE_ENABLED %q: %w", enabled, err)
+		}
+		cfg.QuarantineEnabled = val
+	}
+
+	return cfg, nil
+}
+
+// LoadSpoolConfig reads the settings of the spool keeping aggregates the database could not take.
+// It is enabled unless SPOOL_ENABLED is false and writes segments of SPOOL_SEGMENT_SIZE bytes into SPOOL_DIR,
+// retries start after SPOOL_RETRY_INTERVAL and back off up to SPOOL_RETRY_MAX_INTERVAL.
+func LoadSpoolConfig() (*SpoolConfig, error) {
+	cfg := &SpoolConfig{
+		Enabled:          true,
+		Dir:              "spool",
+		SegmentSize:      8 << 20,
+		RetryInterval:    time.Second,
+		MaxRetryInterval: time.Minute,
+	}
+
+	if enabled := os.Getenv("SPOOL_ENABLED"); enabled != "" {
+		val, err := strconv.ParseBool(enabled)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SPOOL_ENABLED %q: %w", enabled, err)
+		}
+		cfg.Enabled = val
+	}
+
+	if dir := os.Getenv("SPOOL_DIR"); dir != "" {
+		cfg.Dir = dir
+	}
+
+	if size := os.Getenv("SPOOL_SEGMENT_SIZE"); size != "" {
+		val, err := strconv.ParseInt(size, 10, 64)
+		if err != nil || val < 1 {
+			return nil, fmt.Errorf("invalid SPOOL_SEGMENT_SIZE %q, must be a positive number of bytes", size)
+		}
+		cfg.SegmentSize = val
+	}
+
+	if interval := os.Getenv("SPOOL_RETRY_INTERVAL"); interval != "" {
+		val, err := time.ParseDuration(interval)
+		if err != nil || val <= 0 {
+			return nil, fmt.Errorf("invalid SPOOL_RETRY_INTERVAL %q, must be a positive duration", interval)
+		}
+		cfg.RetryInterval = val
+	}
+
+	if interval := os.Getenv("SPOOL_RETRY_MAX_INTERVAL"); interval != "" {
+		val, err := time.ParseDuration(interval)
+		if err != nil || val <= 0 {
+			return nil, fmt.Errorf("invalid SPOOL_RETRY_MAX_INTERVAL %q, must be a positive duration", interval)
+		}
+		cfg.MaxRetryInterval = val
+	}
+
+	if cfg.MaxRetryInterval < cfg.RetryInterval {
+		return nil, fmt.Errorf("SPOOL_RETRY_MAX_INTERVAL %s must not be shorter than SPOOL_RETRY_INTERVAL %s", cfg.MaxRetryInterval, cfg.RetryInterval)
+	}
+
+	return cfg, nil
+}
+
+// LoadRetentionConfig reads the retention tiers of the stored aggregates. It is disabled unless RETENTION_ENABLED is true.
+// Window rows are kept for RETENTION_BASE and rolled up into the RETENTION_TIERS, a comma separated list of
+// resolution:retention pairs, every RETENTION_INTERVAL. Retentions take a "d" suffix for days or "forever".
+func LoadRetentionConfig(window time.Duration) (*RetentionConfig, error) {
+	cfg := &RetentionConfig{
+		Base: 7 * 24 * time.Hour,
+		Tiers: []RetentionTier{
+			{Resolution: time.Hour, Retention: 90 * 24 * time.Hour},
+			{Resolution: 24 * time.Hour},
+		},
+		Interval: time.Hour,
+	}
+
+	if enabled := os.Getenv("RETENTION_ENABLED"); enabled != "" {
+		val, err := strconv.ParseBool(enabled)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RETENTION_ENABLED %q: %w", enabled, err)
+		}
+		cfg.Enabled = val
+	}
+
+	if raw := os.Getenv("RETENTION_BASE"); raw != "" {
+		val, err := parseRetention(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RETENTION_BASE %q: %w", raw, err)
+		}
+		cfg.Base = val
+	}
+
+	if raw := os.Getenv("RETENTION_TIERS"); raw != "" {
+		cfg.Tiers = nil
+		for _, entry := range strings.Split(raw, ",") {
+			resolution, retention, ok := strings.Cut(strings.TrimSpace(entry), ":")
+			if !ok {
+				return nil, fmt.Errorf("invalid RETENTION_TIERS entry %q, must be resolution:retention", entry)
+			}
+
+			res, err := parseRetention(resolution)
+			if err != nil || res == 0 {
+				return nil, fmt.Errorf("invalid RETENTION_TIERS resolution %q, must be a positive duration", resolution)
+			}
+			ret, err := parseRetention(retention)
+			if err != nil {
+				return nil, fmt.Errorf("invalid RETENTION_TIERS retention %q: %w", retention, err)
+			}
+			cfg.Tiers = append(cfg.Tiers, RetentionTier{Resolution: res, Retention: ret})
+		}
+	}
+
+	if interval := os.Getenv("RETENTION_INTERVAL"); interval != "" {
+		val, err := time.ParseDuration(interval)
+		if err != nil || val <= 0 {
+			return nil, fmt.Errorf("invalid RETENTION_INTERVAL %q, must be a positive duration", interval)
+		}
+		cfg.Interval = val
+	}
+
+	// Every tier is rolled up from the one before, so it has to be coarser and kept at least as long
+	prev := RetentionTier{Resolution: window, Retention: cfg.Base}
+	for _, tier := range cfg.Tiers {
+		if tier.Resolution <= prev.Resolution || tier.Resolution%prev.Resolution != 0 || tier.Resolution%time.Second != 0 {
+			return nil, fmt.Errorf("retention tier resolution %s must be whole seconds and a multiple of the finer resolution %s", tier.Resolution, prev.Resolution)
+		}
+		if prev.Retention == 0 || (tier.Retention != 0 && tier.Retention < prev.Retention) {
+			return nil, fmt.Errorf("retention of the %s tier must not be shorter than the retention of the finer tiers", tier.Resolution)
+		}
+		prev = tier
+	}
+
+	return cfg, nil
+}
+
+// A duration that may also be given in days, "forever" is 0
+func parseRetention(raw string) (time.Duration, error) {
+	if raw == "forever" {
+		return 0, nil
+	}
+
+	if days, ok := strings.CutSuffix(raw, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 1 {
+			return 0, errors.New("must be a positive number of days")
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	val, err := time.ParseDuration(raw)
+	if err != nil || val <= 0 {
+		return 0, errors.New("must be a positive duration, a number of days or forever")
+	}
+	return val, nil
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLoadExchangeConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    string
+		want    *ExchangeConfig
+		wantErr bool
+	}{
+		{
+			name: "named and positional",
+			list: "Binance=exchange1:40101, exchange2:40102",
+			want: &ExchangeConfig{Names: []string{"Binance", "Exchange2"}, ExchHosts: []string{"exchange1", "exchange2"}, Ports: []string{"40101", "40102"}},
+		},
+		{
+			name: "ipv6",
+			list: "Exchange1=[::1]:40101,[fe80::1]:40102",
+			want: &ExchangeConfig{Names: []string{"Exchange1", "Exchange2"}, ExchHosts: []string{"::1", "fe80::1"}, Ports: []string{"40101", "40102"}},
+		},
+		{name: "unbracketed ipv6", list: "::1:40101", wantErr: true},
+		{name: "missing port", list: "exchange1", wantErr: true},
+		{name: "empty port", list: "exchange1:", wantErr: true},
+		{name: "reserved name", list: "All=exchange1:40101", wantErr: true},
+		{name: "duplicate name", list: "A=exchange1:40101,A=exchange2:40102", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("EXCHANGES", tt.list)
+
+			got, err := LoadExchangeConfig()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
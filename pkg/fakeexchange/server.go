@@ -0,0 +1,214 @@
+// Package fakeexchange is a TCP server streaming newline-delimited JSON prices in the format
+// of the exchange programs, for local development and tests without the exchange images.
+package fakeexchange
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+var defaultPrices = map[string]float64{
+	"BTCUSDT": 60000.0, "DOGEUSDT": 0.15, "TONUSDT": 5.0, "SOLUSDT": 150.0, "ETHUSDT": 3000.0,
+}
+
+// Config of a fake exchange, zero values fall back to the defaults
+type Config struct {
+	Addr            string             // listen address, ":0" picks a free port (default)
+	Symbols         []string           // symbols sent, all known symbols by default
+	Prices          map[string]float64 // starting prices, known defaults or 1
+	Rate            float64            // lines per second and connection, 10 by default
+	Volatility      float64            // relative standard deviation of a price step, 0.0005 by default
+	DisconnectEvery time.Duration      // connections are closed by the server after this long, never if zero
+	MalformedRate   float64            // share of lines sent malformed, in [0, 1]
+	Seed            int64              // seed of prices and malformed lines, random if zero
+}
+
+// Line is one price update, the format read by the marketflow workers
+type Line struct {
+	Symbol    string  `json:"symbol"`
+	Price     float64 `json:"price"`
+	Timestamp int64   `json:"timestamp"`
+}
+
+type Server struct {
+	cfg      Config
+	listener net.Listener
+
+	mu     sync.Mutex
+	rng    *rand.Rand
+	prices map[string]float64
+	next   int
+	conns  map[net.Conn]struct{}
+	closed bool
+
+	wg sync.WaitGroup
+}
+
+func New(cfg Config) *Server {
+	if cfg.Addr == "" {
+		cfg.Addr = ":0"
+	}
+	if len(cfg.Symbols) == 0 {
+		for symbol := range defaultPrices {
+			cfg.Symbols = append(cfg.Symbols, symbol)
+		}
+		// Symbols take turns by index, so the same seed moves the same symbols the same way
+		sort.Strings(cfg.Symbols)
+	}
+	if cfg.Rate <= 0 {
+		cfg.Rate = 10
+	}
+	if cfg.Volatility <= 0 {
+		cfg.Volatility = 0.0005
+	}
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+
+	prices := make(map[string]float64, len(cfg.Symbols))
+	for _, symbol := range cfg.Symbols {
+		price, ok := cfg.Prices[symbol]
+		if !ok {
+			price, ok = defaultPrices[symbol]
+		}
+		if !ok {
+			price = 1
+		}
+		prices[symbol] = price
+	}
+
+	return &Server{
+		cfg:    cfg,
+		rng:    rand.New(rand.NewSource(cfg.Seed)),
+		prices: prices,
+		conns:  make(map[net.Conn]struct{}),
+	}
+}
+
+// Start listens on the configured address and serves connections in the background
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+
+	s.wg.Add(1)
+	go s.accept()
+	return nil
+}
+
+// Addr returns the address the server listens on
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Connections returns the number of connected clients
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+// DropConnections closes every client connection, the server keeps accepting new ones
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// Close stops accepting, closes every connection and waits for the server goroutines
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+
+	err := s.listener.Close()
+	s.DropConnections()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.serve(conn)
+	}
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / s.cfg.Rate))
+	defer ticker.Stop()
+
+	var disconnect <-chan time.Time
+	if s.cfg.DisconnectEvery > 0 {
+		timer := time.NewTimer(s.cfg.DisconnectEvery)
+		defer timer.Stop()
+		disconnect = timer.C
+	}
+
+	for {
+		select {
+		case <-disconnect:
+			return
+		case <-ticker.C:
+			if _, err := conn.Write(s.nextLine()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Symbols take turns, every price moves by a random step when it is sent
+func (s *Server) nextLine() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	symbol := s.cfg.Symbols[s.next%len(s.cfg.Symbols)]
+	s.next++
+
+	if s.rng.Float64() < s.cfg.MalformedRate {
+		return []byte(`{"symbol":"` + symbol + `","price":` + "\n")
+	}
+
+	price := s.prices[symbol] * math.Exp(s.cfg.Volatility*s.rng.NormFloat64())
+	s.prices[symbol] = price
+
+	payload, _ := json.Marshal(Line{Symbol: symbol, Price: price, Timestamp: time.Now().UnixMilli()})
+	return append(payload, '\n')
+}
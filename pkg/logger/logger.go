@@ -6,7 +6,8 @@ import (
 	"os"
 )
 
-var Log *slog.Logger
+// Log is replaced by Init, the default logger is used until then
+var Log = slog.Default()
 
 func Init() {
 	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{})
@@ -0,0 +1,202 @@
+// Package metrics holds the Prometheus collectors of the pipeline and serves them in the text format
+package metrics
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Store labels
+const (
+	Postgres = "postgres"
+	Redis    = "redis"
+)
+
+// Cache lookup results
+const (
+	CacheHit   = "hit"
+	CacheMiss  = "miss"
+	CacheError = "error"
+)
+
+var (
+	TicksReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "marketflow_ticks_received_total",
+		Help: "Ticks entering aggregation, by exchange and symbol.",
+	}, []string{"exchange", "symbol"})
+
+	UnmarshalErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "marketflow_worker_unmarshal_errors_total",
+		Help: "Exchange lines the workers failed to parse, by exchange.",
+	}, []string{"exchange"})
+
+	TicksRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "marketflow_ticks_rejected_total",
+		Help: "Ticks dropped by validation before aggregation, by exchange and reason.",
+	}, []string{"exchange", "reason"})
+
+	TicksLate = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "marketflow_ticks_late_total",
+		Help: "Ticks arriving after their window was flushed, by exchange and the action taken on them.",
+	}, []string{"exchange", "action"})
+
+	ClockSkew = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "marketflow_exchange_clock_skew_seconds",
+		Help: "Smoothed receive time minus exchange timestamp of the ticks, by exchange.",
+	}, []string{"exchange"})
+
+	SpoolRecords = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "marketflow_spool_records",
+		Help: "Aggregate flushes spooled on disk and not yet written into the database.",
+	})
+
+	SpoolBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "marketflow_spool_bytes",
+		Help: "Size of the spooled aggregate flushes not yet written into the database.",
+	})
+
+	SpoolReplayed = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "marketflow_spool_replayed_total",
+		Help: "Spooled aggregate flushes written into the database.",
+	})
+
+	RetentionRolledUp = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "marketflow_retention_rolled_up_rows_total",
+		Help: "Rows written by the retention rollups, by resolution.",
+	}, []string{"resolution"})
+
+	RetentionDeleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "marketflow_retention_deleted_rows_total",
+		Help: "Aggregate rows deleted past their retention, by resolution.",
+	}, []string{"resolution"})
+
+	BatchSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "marketflow_fanin_batch_size",
+		Help:    "Ticks per batch emitted by the fan-in.",
+		Buckets: prometheus.ExponentialBuckets(1, 4, 8),
+	})
+
+	StoreDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "marketflow_store_operation_duration_seconds",
+		Help:    "Latency of store writes, by store and operation.",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 4, 8),
+	}, []string{"store", "operation"})
+
+	StoreErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "marketflow_store_operation_errors_total",
+		Help: "Failed store writes, by store and operation.",
+	}, []string{"store", "operation"})
+
+	CacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "marketflow_cache_lookups_total",
+		Help: "Latest price lookups in the cache, by result (hit, miss or error).",
+	}, []string{"result"})
+
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "marketflow_http_request_duration_seconds",
+		Help:    "Duration of HTTP requests, by route pattern, method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+)
+
+// Registry holds the collectors of the service and of the Go runtime
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		TicksReceived,
+		UnmarshalErrors,
+		TicksRejected,
+		TicksLate,
+		ClockSkew,
+		SpoolRecords,
+		SpoolBytes,
+		SpoolReplayed,
+		RetentionRolledUp,
+		RetentionDeleted,
+		BatchSize,
+		StoreDuration,
+		StoreErrors,
+		CacheLookups,
+		HTTPDuration,
+	)
+}
+
+// Handler serves the registry in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveStore records the latency of a store operation started at start and counts it if it failed
+func ObserveStore(store, operation string, start time.Time, err error) {
+	StoreDuration.WithLabelValues(store, operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		StoreErrors.WithLabelValues(store, operation).Inc()
+	}
+}
+
+// Instrument records the duration of every request by the route pattern it matched
+func Instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		// The mux sets the pattern on the request while routing it
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		HTTPDuration.WithLabelValues(route, r.Method, strconv.Itoa(rec.code)).Observe(time.Since(start).Seconds())
+	})
+}
+
+// Keeps the status code while passing flushing and hijacking through for the streaming handlers
+type statusRecorder struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.code, r.wroteHeader = code, true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not implement http.Hijacker")
+	}
+	// A hijacked connection has switched protocols
+	r.code, r.wroteHeader = http.StatusSwitchingProtocols, true
+	return hijacker.Hijack()
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}